@@ -0,0 +1,299 @@
+// Package ansi 解析 MUD 服务器输出中的 ANSI 控制码，
+// 把文本拆分为带有显示属性的片段，供界面渲染、日志等模块使用。
+package ansi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ColorType 表示颜色的种类
+type ColorType uint8
+
+const (
+	ColorDefault ColorType = iota // 终端默认颜色
+	ColorIndex                    // 256 色调色板中的颜色，0~15 为基本颜色
+	ColorRGB                      // 24 位真彩色
+)
+
+// Color 是一个 ANSI 颜色，Value 的含义由 Type 决定：
+// ColorIndex 时为调色板序号，ColorRGB 时为 0xRRGGBB。
+type Color struct {
+	Type  ColorType
+	Value uint32
+}
+
+// Style 是 SGR 控制码所描述的显示属性
+type Style struct {
+	Fg, Bg    Color
+	Bold      bool
+	Dim       bool
+	Italic    bool
+	Underline bool
+	Blink     bool
+	Reverse   bool
+	Strike    bool
+}
+
+// Segment 是一段显示属性相同的文本
+type Segment struct {
+	Text  string
+	Style Style
+}
+
+// csiRe 匹配 CSI 控制序列，其中 SGR 序列以 m 结尾
+var csiRe = regexp.MustCompile("\x1b" + `\[([\d;:]*)([\x20-\x2f]*)([\x40-\x7e])`)
+
+// Strip 去掉 str 中所有的 CSI 控制序列，返回纯文本
+func Strip(str string) string {
+	if !strings.Contains(str, "\x1b") {
+		return str
+	}
+
+	return strings.ReplaceAll(csiRe.ReplaceAllString(str, ""), "\x1b", "")
+}
+
+// Parse 把 line 拆分为若干片段，style 为行首时的显示属性，
+// 返回值中的 Style 为行尾时的显示属性，可以传给下一行继续使用。
+func Parse(line string, style Style) ([]Segment, Style) {
+	var segments []Segment
+
+	pos := 0
+	for _, loc := range csiRe.FindAllStringSubmatchIndex(line, -1) {
+		if loc[0] > pos {
+			segments = appendSegment(segments, line[pos:loc[0]], style)
+		}
+		pos = loc[1]
+
+		if line[loc[6]:loc[7]] == "m" {
+			style.Apply(line[loc[2]:loc[3]])
+		}
+	}
+
+	if pos < len(line) {
+		segments = appendSegment(segments, line[pos:], style)
+	}
+
+	return segments, style
+}
+
+func appendSegment(segments []Segment, text string, style Style) []Segment {
+	text = strings.ReplaceAll(text, "\x1b", "")
+	if text == "" {
+		return segments
+	}
+
+	if n := len(segments); n > 0 && segments[n-1].Style == style {
+		segments[n-1].Text += text
+		return segments
+	}
+
+	return append(segments, Segment{Text: text, Style: style})
+}
+
+// Apply 把 SGR 控制码的参数（例如 "1;31"）作用到 style 上
+func (style *Style) Apply(params string) {
+	fields := strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ':' })
+	if len(fields) == 0 {
+		*style = Style{}
+		return
+	}
+
+	codes := make([]int, len(fields))
+	for i, field := range fields {
+		codes[i], _ = strconv.Atoi(field)
+	}
+
+	for i := 0; i < len(codes); i++ {
+		code := codes[i]
+		switch {
+		case code == 0:
+			*style = Style{}
+		case code == 1:
+			style.Bold = true
+		case code == 2:
+			style.Dim = true
+		case code == 3:
+			style.Italic = true
+		case code == 4:
+			style.Underline = true
+		case code == 5 || code == 6:
+			style.Blink = true
+		case code == 7:
+			style.Reverse = true
+		case code == 9:
+			style.Strike = true
+		case code == 21 || code == 22:
+			style.Bold = false
+			style.Dim = false
+		case code == 23:
+			style.Italic = false
+		case code == 24:
+			style.Underline = false
+		case code == 25:
+			style.Blink = false
+		case code == 27:
+			style.Reverse = false
+		case code == 29:
+			style.Strike = false
+		case code >= 30 && code <= 37:
+			style.Fg = Color{ColorIndex, uint32(code - 30)}
+		case code == 38:
+			style.Fg, i = extendedColor(codes, i)
+		case code == 39:
+			style.Fg = Color{}
+		case code >= 40 && code <= 47:
+			style.Bg = Color{ColorIndex, uint32(code - 40)}
+		case code == 48:
+			style.Bg, i = extendedColor(codes, i)
+		case code == 49:
+			style.Bg = Color{}
+		case code >= 90 && code <= 97:
+			style.Fg = Color{ColorIndex, uint32(code - 90 + 8)}
+		case code >= 100 && code <= 107:
+			style.Bg = Color{ColorIndex, uint32(code - 100 + 8)}
+		}
+	}
+}
+
+// extendedColor 解析 38/48 之后的 5;n 或 2;r;g;b 参数，返回颜色及最后一个被使用的参数下标
+func extendedColor(codes []int, i int) (Color, int) {
+	if i+2 < len(codes) && codes[i+1] == 5 {
+		return Color{ColorIndex, uint32(codes[i+2] & 0xFF)}, i + 2
+	}
+
+	if i+4 < len(codes) && codes[i+1] == 2 {
+		r, g, b := codes[i+2]&0xFF, codes[i+3]&0xFF, codes[i+4]&0xFF
+		return Color{ColorRGB, uint32(r<<16 | g<<8 | b)}, i + 4
+	}
+
+	return Color{}, len(codes)
+}
+
+// EffectiveFg 返回实际显示的前景色：粗体的基本颜色按照惯例显示为对应的高亮颜色
+func (style Style) EffectiveFg() Color {
+	if style.Bold && style.Fg.Type == ColorIndex && style.Fg.Value < 8 {
+		return Color{ColorIndex, style.Fg.Value + 8}
+	}
+
+	return style.Fg
+}
+
+// Index 返回 line 去掉控制序列后的纯文本，以及纯文本中每个字节在 line 中的位置。
+// index 比纯文本多一个元素，最后一个元素为 len(line)。
+func Index(line string) (plain string, index []int) {
+	var b strings.Builder
+	index = make([]int, 0, len(line)+1)
+
+	pos := 0
+	for _, loc := range csiRe.FindAllStringIndex(line, -1) {
+		for ; pos < loc[0]; pos++ {
+			b.WriteByte(line[pos])
+			index = append(index, pos)
+		}
+		pos = loc[1]
+	}
+	for ; pos < len(line); pos++ {
+		b.WriteByte(line[pos])
+		index = append(index, pos)
+	}
+	index = append(index, len(line))
+
+	return b.String(), index
+}
+
+// StyleAt 返回 line 中第 pos 个字节处的显示属性，style 为行首时的显示属性
+func StyleAt(line string, pos int, style Style) Style {
+	for _, loc := range csiRe.FindAllStringSubmatchIndex(line, -1) {
+		if loc[0] >= pos {
+			break
+		}
+		if line[loc[6]:loc[7]] == "m" {
+			style.Apply(line[loc[2]:loc[3]])
+		}
+	}
+
+	return style
+}
+
+// With 返回把 over 中设置了的颜色和属性叠加到 style 上的结果，over 中未设置的部分保持 style 原来的值
+func (style Style) With(over Style) Style {
+	if over.Fg.Type != ColorDefault {
+		style.Fg = over.Fg
+	}
+	if over.Bg.Type != ColorDefault {
+		style.Bg = over.Bg
+	}
+
+	style.Bold = style.Bold || over.Bold
+	style.Dim = style.Dim || over.Dim
+	style.Italic = style.Italic || over.Italic
+	style.Underline = style.Underline || over.Underline
+	style.Blink = style.Blink || over.Blink
+	style.Reverse = style.Reverse || over.Reverse
+	style.Strike = style.Strike || over.Strike
+
+	return style
+}
+
+// SGR 返回完整描述 style 的 SGR 控制序列，该序列总是先重置所有属性
+func (style Style) SGR() string {
+	codes := append([]string{"0"}, style.params()...)
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// Overlay 返回把 style 中设置了的颜色和属性叠加到当前显示属性上的 SGR 控制序列，
+// 未设置的部分保持不变。style 为空时返回空串。
+func (style Style) Overlay() string {
+	codes := style.params()
+	if len(codes) == 0 {
+		return ""
+	}
+
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// params 返回 style 中设置了的颜色和属性所对应的 SGR 参数
+func (style Style) params() []string {
+	var codes []string
+
+	flags := []struct {
+		on   bool
+		code string
+	}{
+		{style.Bold, "1"}, {style.Dim, "2"}, {style.Italic, "3"}, {style.Underline, "4"},
+		{style.Blink, "5"}, {style.Reverse, "7"}, {style.Strike, "9"},
+	}
+	for _, flag := range flags {
+		if flag.on {
+			codes = append(codes, flag.code)
+		}
+	}
+
+	if code := style.Fg.sgr(30); code != "" {
+		codes = append(codes, code)
+	}
+	if code := style.Bg.sgr(40); code != "" {
+		codes = append(codes, code)
+	}
+
+	return codes
+}
+
+// sgr 返回颜色的 SGR 参数，base 为 30（前景）或 40（背景）
+func (c Color) sgr(base int) string {
+	switch {
+	case c.Type == ColorIndex && c.Value < 8:
+		return strconv.Itoa(base + int(c.Value))
+	case c.Type == ColorIndex && c.Value < 16:
+		return strconv.Itoa(base + 60 + int(c.Value) - 8)
+	case c.Type == ColorIndex:
+		return fmt.Sprintf("%d;5;%d", base+8, c.Value)
+	case c.Type == ColorRGB:
+		return fmt.Sprintf("%d;2;%d;%d;%d", base+8, c.Value>>16&0xFF, c.Value>>8&0xFF, c.Value&0xFF)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,200 @@
+package ansi
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	red     = Color{ColorIndex, 1}
+	blue    = Color{ColorIndex, 4}
+	hiGreen = Color{ColorIndex, 10}
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		style    Style
+		segments []Segment
+		end      Style
+	}{
+		{"纯文本", "hello", Style{}, []Segment{{"hello", Style{}}}, Style{}},
+		{"空行", "", Style{Bold: true}, nil, Style{Bold: true}},
+		{
+			"颜色与重置", "\x1b[1;31m红\x1b[0m白",
+			Style{},
+			[]Segment{{"红", Style{Fg: red, Bold: true}}, {"白", Style{}}},
+			Style{},
+		},
+		{
+			"继承行首属性", "a\x1b[44mb",
+			Style{Fg: red},
+			[]Segment{{"a", Style{Fg: red}}, {"b", Style{Fg: red, Bg: blue}}},
+			Style{Fg: red, Bg: blue},
+		},
+		{
+			"属性相同的片段合并", "a\x1b[31mb\x1b[31mc",
+			Style{},
+			[]Segment{{"a", Style{}}, {"bc", Style{Fg: red}}},
+			Style{Fg: red},
+		},
+		{
+			"忽略 SGR 以外的控制序列", "a\x1b[2Kb\x1b",
+			Style{},
+			[]Segment{{"ab", Style{}}},
+			Style{},
+		},
+		{
+			"256 色与真彩色", "\x1b[38;5;208mx\x1b[48;2;1;2;3my",
+			Style{},
+			[]Segment{
+				{"x", Style{Fg: Color{ColorIndex, 208}}},
+				{"y", Style{Fg: Color{ColorIndex, 208}, Bg: Color{ColorRGB, 0x010203}}},
+			},
+			Style{Fg: Color{ColorIndex, 208}, Bg: Color{ColorRGB, 0x010203}},
+		},
+		{
+			"行尾的属性传给下一行", "\x1b[3;9mx\x1b[23m",
+			Style{},
+			[]Segment{{"x", Style{Italic: true, Strike: true}}},
+			Style{Strike: true},
+		},
+	}
+
+	for _, tt := range tests {
+		segments, end := Parse(tt.line, tt.style)
+		if !reflect.DeepEqual(segments, tt.segments) {
+			t.Errorf("%s: Parse(%q) segments = %+v, want %+v", tt.name, tt.line, segments, tt.segments)
+		}
+		if end != tt.end {
+			t.Errorf("%s: Parse(%q) style = %+v, want %+v", tt.name, tt.line, end, tt.end)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		params string
+		style  Style
+		want   Style
+	}{
+		{"", Style{Bold: true, Fg: red}, Style{}},
+		{"0", Style{Underline: true}, Style{}},
+		{"1;2;4;5;7", Style{}, Style{Bold: true, Dim: true, Underline: true, Blink: true, Reverse: true}},
+		{"22;24", Style{Bold: true, Dim: true, Underline: true}, Style{}},
+		{"92;44", Style{}, Style{Fg: hiGreen, Bg: blue}},
+		{"39;49", Style{Fg: red, Bg: blue}, Style{}},
+		{"38:2:255:0:0", Style{}, Style{Fg: Color{ColorRGB, 0xFF0000}}},
+		{"38;5", Style{Fg: red}, Style{}},
+	}
+
+	for _, tt := range tests {
+		style := tt.style
+		style.Apply(tt.params)
+		if style != tt.want {
+			t.Errorf("Apply(%q) on %+v = %+v, want %+v", tt.params, tt.style, style, tt.want)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		str  string
+		want string
+	}{
+		{"hello", "hello"},
+		{"\x1b[1;31m你好\x1b[0m", "你好"},
+		{"a\x1b[2Kb\x1bc", "abc"},
+	}
+
+	for _, tt := range tests {
+		if got := Strip(tt.str); got != tt.want {
+			t.Errorf("Strip(%q) = %q, want %q", tt.str, got, tt.want)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	tests := []struct {
+		line  string
+		plain string
+		index []int
+	}{
+		{"", "", []int{0}},
+		{"ab", "ab", []int{0, 1, 2}},
+		{"\x1b[31mab\x1b[0m", "ab", []int{5, 6, 11}},
+		{"a\x1b[1mb", "ab", []int{0, 5, 6}},
+		{"\x1b[1m中", "中", []int{4, 5, 6, 7}},
+	}
+
+	for _, tt := range tests {
+		plain, index := Index(tt.line)
+		if plain != tt.plain || !reflect.DeepEqual(index, tt.index) {
+			t.Errorf("Index(%q) = %q, %v, want %q, %v", tt.line, plain, index, tt.plain, tt.index)
+		}
+	}
+}
+
+func TestStyleAt(t *testing.T) {
+	line := "a\x1b[31mb\x1b[1mc\x1b[0md"
+	tests := []struct {
+		pos   int
+		style Style
+		want  Style
+	}{
+		{0, Style{}, Style{}},
+		{0, Style{Bg: blue}, Style{Bg: blue}},
+		{6, Style{}, Style{Fg: red}},
+		{11, Style{}, Style{Fg: red, Bold: true}},
+		{11, Style{Bg: blue}, Style{Fg: red, Bg: blue, Bold: true}},
+		{16, Style{Bg: blue}, Style{}},
+	}
+
+	for _, tt := range tests {
+		if got := StyleAt(line, tt.pos, tt.style); got != tt.want {
+			t.Errorf("StyleAt(%q, %d, %+v) = %+v, want %+v", line, tt.pos, tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestWith(t *testing.T) {
+	tests := []struct {
+		style Style
+		over  Style
+		want  Style
+	}{
+		{Style{Fg: red, Bg: blue}, Style{}, Style{Fg: red, Bg: blue}},
+		{Style{Fg: red, Bg: blue}, Style{Fg: hiGreen}, Style{Fg: hiGreen, Bg: blue}},
+		{Style{Italic: true}, Style{Bold: true, Reverse: true}, Style{Bold: true, Italic: true, Reverse: true}},
+		{Style{Underline: true}, Style{Bg: red}, Style{Bg: red, Underline: true}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.style.With(tt.over); got != tt.want {
+			t.Errorf("%+v.With(%+v) = %+v, want %+v", tt.style, tt.over, got, tt.want)
+		}
+	}
+}
+
+func TestSGR(t *testing.T) {
+	tests := []struct {
+		style   Style
+		sgr     string
+		overlay string
+	}{
+		{Style{}, "\x1b[0m", ""},
+		{Style{Bold: true, Fg: red}, "\x1b[0;1;31m", "\x1b[1;31m"},
+		{Style{Fg: hiGreen, Bg: Color{ColorIndex, 208}}, "\x1b[0;92;48;5;208m", "\x1b[92;48;5;208m"},
+		{Style{Strike: true, Fg: Color{ColorRGB, 0x102030}}, "\x1b[0;9;38;2;16;32;48m", "\x1b[9;38;2;16;32;48m"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.style.SGR(); got != tt.sgr {
+			t.Errorf("%+v.SGR() = %q, want %q", tt.style, got, tt.sgr)
+		}
+		if got := tt.style.Overlay(); got != tt.overlay {
+			t.Errorf("%+v.Overlay() = %q, want %q", tt.style, got, tt.overlay)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package ansi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Palette 是 16 种基本颜色的 RGB 值，依次为黑、红、绿、黄、蓝、紫、青、白及其高亮色
+type Palette [16]uint32
+
+// DefaultPalette 是默认的基本颜色，与 xterm 的默认配色相近
+var DefaultPalette = Palette{
+	0x000000, 0xC00000, 0x00C200, 0xC7C400, 0x0037DA, 0xC000C0, 0x00C0C0, 0xC7C7C7,
+	0x7F7F7F, 0xFF0000, 0x00FF00, 0xFFFF00, 0x5C5CFF, 0xFF00FF, 0x00FFFF, 0xFFFFFF,
+}
+
+// RGB 返回颜色的 RGB 值，ok 为 false 表示该颜色为终端默认颜色
+func (c Color) RGB(palette *Palette) (rgb uint32, ok bool) {
+	switch c.Type {
+	case ColorIndex:
+		return indexRGB(c.Value, palette), true
+	case ColorRGB:
+		return c.Value, true
+	default:
+		return 0, false
+	}
+}
+
+// Hex 返回 #rrggbb 形式的颜色，终端默认颜色返回空串
+func (c Color) Hex(palette *Palette) string {
+	rgb, ok := c.RGB(palette)
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("#%06x", rgb)
+}
+
+// indexRGB 把 256 色调色板中的序号转换为 RGB 值
+func indexRGB(index uint32, palette *Palette) uint32 {
+	switch {
+	case index < 16:
+		return palette[index]
+	case index < 232:
+		// 6x6x6 的颜色立方体
+		index -= 16
+		levels := [6]uint32{0x00, 0x5F, 0x87, 0xAF, 0xD7, 0xFF}
+		return levels[index/36]<<16 | levels[index/6%6]<<8 | levels[index%6]
+	default:
+		// 24 级灰度
+		grey := 8 + (index-232)*10
+		return grey<<16 | grey<<8 | grey
+	}
+}
+
+// colorNames 是基本颜色的名称，hi 或 bright 前缀表示高亮色
+var colorNames = map[string]uint32{
+	"black":   0,
+	"red":     1,
+	"green":   2,
+	"yellow":  3,
+	"blue":    4,
+	"magenta": 5,
+	"cyan":    6,
+	"white":   7,
+	"gray":    8,
+	"grey":    8,
+}
+
+// ParseColor 解析颜色名称，支持基本颜色名称（如 red、hired、brightred）、
+// 256 色调色板序号（如 208）以及 #rrggbb 形式的真彩色，空串或 default 表示默认颜色。
+func ParseColor(name string) (Color, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case name == "" || name == "default" || name == "-":
+		return Color{}, nil
+	case strings.HasPrefix(name, "#"):
+		rgb, err := strconv.ParseUint(name[1:], 16, 32)
+		if err != nil || len(name) != 7 {
+			return Color{}, fmt.Errorf("无效的颜色: %s", name)
+		}
+		return Color{ColorRGB, uint32(rgb)}, nil
+	case name[0] >= '0' && name[0] <= '9':
+		index, err := strconv.Atoi(name)
+		if err != nil || index > 255 {
+			return Color{}, fmt.Errorf("无效的颜色: %s", name)
+		}
+		return Color{ColorIndex, uint32(index)}, nil
+	}
+
+	bright := false
+	for _, prefix := range []string{"bright", "hi", "light"} {
+		if strings.HasPrefix(name, prefix) {
+			name = strings.TrimPrefix(name, prefix)
+			bright = true
+			break
+		}
+	}
+
+	index, ok := colorNames[name]
+	if !ok {
+		return Color{}, fmt.Errorf("无效的颜色: %s", name)
+	}
+	if bright && index < 8 {
+		index += 8
+	}
+
+	return Color{ColorIndex, index}, nil
+}
+
+// ParseStyle 解析 "前景色:背景色:属性" 形式的样式描述，各部分都可以省略。
+// 属性由以下字母组成：b 粗体，d 暗色，i 斜体，u 下划线，l 闪烁，r 反显，s 删除线。
+func ParseStyle(spec string) (Style, error) {
+	var style Style
+	var err error
+
+	parts := strings.SplitN(spec, ":", 3)
+	if style.Fg, err = ParseColor(parts[0]); err != nil {
+		return style, err
+	}
+	if len(parts) > 1 {
+		if style.Bg, err = ParseColor(parts[1]); err != nil {
+			return style, err
+		}
+	}
+	if len(parts) > 2 {
+		for _, attr := range parts[2] {
+			switch attr {
+			case 'b':
+				style.Bold = true
+			case 'd':
+				style.Dim = true
+			case 'i':
+				style.Italic = true
+			case 'u':
+				style.Underline = true
+			case 'l':
+				style.Blink = true
+			case 'r':
+				style.Reverse = true
+			case 's':
+				style.Strike = true
+			default:
+				return style, fmt.Errorf("无效的属性: %c", attr)
+			}
+		}
+	}
+
+	return style, nil
+}
+
+// ParsePalette 以 DefaultPalette 为基础，根据 colors 修改其中的基本颜色。
+// colors 的键为基本颜色名称（如 red、brightred）或序号 0~15，值为 #rrggbb 形式的颜色。
+func ParsePalette(colors map[string]string) (Palette, error) {
+	palette := DefaultPalette
+
+	for name, value := range colors {
+		base, err := ParseColor(name)
+		if err != nil || base.Type != ColorIndex || base.Value >= 16 {
+			return palette, fmt.Errorf("无效的基本颜色: %s", name)
+		}
+
+		c, err := ParseColor(value)
+		if err != nil {
+			return palette, err
+		}
+		rgb, ok := c.RGB(&DefaultPalette)
+		if !ok {
+			return palette, fmt.Errorf("基本颜色 %s 不能设置为默认颜色", name)
+		}
+
+		palette[base.Value] = rgb
+	}
+
+	return palette, nil
+}
+
+// Downsample 把颜色转换为调色板前 colors 种颜色中最接近的一种，colors 通常为 16 或 256
+func (c Color) Downsample(palette *Palette, colors int) Color {
+	if c.Type == ColorDefault || c.Type == ColorIndex && c.Value < uint32(colors) {
+		return c
+	}
+
+	rgb, _ := c.RGB(palette)
+	best, bestDistance := 0, -1
+	for i := 0; i < colors && i < 256; i++ {
+		distance := colorDistance(rgb, indexRGB(uint32(i), palette))
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+
+	return Color{ColorIndex, uint32(best)}
+}
+
+// colorDistance 返回两种颜色之间的距离，按照人眼对红绿蓝的敏感程度加权
+func colorDistance(a, b uint32) int {
+	dr := int(a>>16&0xFF) - int(b>>16&0xFF)
+	dg := int(a>>8&0xFF) - int(b>>8&0xFF)
+	db := int(a&0xFF) - int(b&0xFF)
+
+	return 3*dr*dr + 4*dg*dg + 2*db*db
+}
@@ -0,0 +1,120 @@
+package ansi
+
+import (
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		name string
+		want Color
+		err  bool
+	}{
+		{"", Color{}, false},
+		{"default", Color{}, false},
+		{"Red", Color{ColorIndex, 1}, false},
+		{"hired", Color{ColorIndex, 9}, false},
+		{"brightblue", Color{ColorIndex, 12}, false},
+		{"grey", Color{ColorIndex, 8}, false},
+		{"208", Color{ColorIndex, 208}, false},
+		{"#FF8000", Color{ColorRGB, 0xFF8000}, false},
+		{"256", Color{}, true},
+		{"#FF80", Color{}, true},
+		{"orange", Color{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseColor(tt.name)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseColor(%q) = %+v, %v, want %+v, error %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestParseStyle(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Style
+		err  bool
+	}{
+		{"red", Style{Fg: Color{ColorIndex, 1}}, false},
+		{":blue", Style{Bg: Color{ColorIndex, 4}}, false},
+		{"hiyellow::bu", Style{Fg: Color{ColorIndex, 11}, Bold: true, Underline: true}, false},
+		{"::dilrs", Style{Dim: true, Italic: true, Blink: true, Reverse: true, Strike: true}, false},
+		{"::x", Style{}, true},
+		{"nocolor", Style{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseStyle(tt.spec)
+		if (err != nil) != tt.err || !tt.err && got != tt.want {
+			t.Errorf("ParseStyle(%q) = %+v, %v, want %+v, error %v", tt.spec, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestParsePalette(t *testing.T) {
+	palette, err := ParsePalette(map[string]string{"red": "#800000", "15": "#EEEEEE"})
+	if err != nil {
+		t.Fatalf("ParsePalette() error: %v", err)
+	}
+	if palette[1] != 0x800000 || palette[15] != 0xEEEEEE || palette[2] != DefaultPalette[2] {
+		t.Errorf("ParsePalette() = %06x", palette)
+	}
+
+	for _, colors := range []map[string]string{
+		{"208": "#000000"},
+		{"red": "default"},
+		{"red": "nocolor"},
+	} {
+		if _, err := ParsePalette(colors); err == nil {
+			t.Errorf("ParsePalette(%v) should fail", colors)
+		}
+	}
+}
+
+func TestRGB(t *testing.T) {
+	tests := []struct {
+		color Color
+		hex   string
+	}{
+		{Color{}, ""},
+		{Color{ColorIndex, 1}, "#c00000"},
+		{Color{ColorIndex, 16}, "#000000"},
+		{Color{ColorIndex, 196}, "#ff0000"},
+		{Color{ColorIndex, 231}, "#ffffff"},
+		{Color{ColorIndex, 232}, "#080808"},
+		{Color{ColorIndex, 255}, "#eeeeee"},
+		{Color{ColorRGB, 0x123456}, "#123456"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.color.Hex(&DefaultPalette); got != tt.hex {
+			t.Errorf("%+v.Hex() = %q, want %q", tt.color, got, tt.hex)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	tests := []struct {
+		color  Color
+		colors int
+		want   Color
+	}{
+		{Color{}, 16, Color{}},
+		{Color{ColorIndex, 9}, 16, Color{ColorIndex, 9}},
+		{Color{ColorIndex, 208}, 256, Color{ColorIndex, 208}},
+		{Color{ColorRGB, 0xFF0000}, 16, Color{ColorIndex, 9}},
+		{Color{ColorRGB, 0xFF0000}, 256, Color{ColorIndex, 9}},
+		{Color{ColorRGB, 0xFF8700}, 256, Color{ColorIndex, 208}},
+		{Color{ColorRGB, 0x080808}, 16, Color{ColorIndex, 0}},
+		{Color{ColorIndex, 196}, 16, Color{ColorIndex, 9}},
+		{Color{ColorIndex, 244}, 16, Color{ColorIndex, 8}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.color.Downsample(&DefaultPalette, tt.colors); got != tt.want {
+			t.Errorf("%+v.Downsample(%d) = %+v, want %+v", tt.color, tt.colors, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mudclient/go-mud/rules"
+)
+
+// slashCmd 处理带参数的斜杠命令，如果 cmd 不是已知的命令则返回 false
+func (c *Client) slashCmd(cmd string) bool {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return false
+	}
+
+	args := fields[1:]
+	switch fields[0] {
+	case "/window":
+		c.windowCmd(args)
+	case "/log":
+		c.logCmd(args)
+	case "/highlight":
+		c.highlightCmd(args)
+	case "/gag":
+		c.gagCmd(args)
+	case "/rules":
+		c.rulesCmd(args)
+	case "/plugin":
+		c.pluginCmd(args)
+	case "/timers":
+		c.timersCmd(args)
+	case "/lua":
+		c.luaCmd(args)
+	case "/timestamp":
+		if c.ui.ToggleTimestamp() {
+			c.ui.Println("已开启时间戳显示。")
+		} else {
+			c.ui.Println("已关闭时间戳显示。")
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+// windowCmd 处理 /window [name [show|hide|clear|size N]] 命令，
+// 不带参数时列出所有附加窗口，只带窗口名称时切换该窗口的显示状态
+func (c *Client) windowCmd(args []string) {
+	if len(args) == 0 {
+		windows := c.ui.Windows()
+		if len(windows) == 0 {
+			c.ui.Println("目前没有附加窗口。")
+		}
+		for _, w := range windows {
+			c.ui.Println(w)
+		}
+		return
+	}
+
+	var err error
+	name := args[0]
+	switch {
+	case len(args) == 1:
+		err = c.ui.ToggleWindow(name)
+	case args[1] == "show":
+		err = c.ui.ShowWindow(name, true)
+	case args[1] == "hide":
+		err = c.ui.ShowWindow(name, false)
+	case args[1] == "clear":
+		err = c.ui.ClearWindow(name)
+	case args[1] == "size" && len(args) == 3:
+		var size int
+		if size, err = strconv.Atoi(args[2]); err == nil {
+			err = c.ui.ResizeWindow(name, size)
+		}
+	default:
+		c.ui.Println("用法: /window [name [show|hide|clear|size N]]")
+		return
+	}
+
+	if err != nil {
+		c.ui.Printf("/window: %v\n", err)
+	}
+}
+
+// logCmd 处理 /log [start [plain|ansi|html]|stop|mark [note]] 命令，不带参数时显示日志状态
+func (c *Client) logCmd(args []string) {
+	if len(args) == 0 {
+		if running, name := c.logger.Running(); running {
+			c.ui.Printf("正在记录日志到 %s\n", name)
+		} else {
+			c.ui.Println("没有在记录日志。")
+		}
+		return
+	}
+
+	var err error
+	switch args[0] {
+	case "start":
+		format := ""
+		if len(args) > 1 {
+			format = args[1]
+		}
+		if err = c.logger.Start(format); err == nil {
+			_, name := c.logger.Running()
+			c.ui.Printf("开始记录日志到 %s\n", name)
+		}
+	case "stop":
+		if err = c.logger.Stop(); err == nil {
+			c.ui.Println("日志记录已停止。")
+		}
+	case "mark":
+		err = c.logger.Mark(strings.Join(args[1:], " "))
+	default:
+		c.ui.Println("用法: /log [start [plain|ansi|html]|stop|mark [note]]")
+		return
+	}
+
+	if err != nil {
+		c.ui.Printf("/log: %v\n", err)
+	}
+}
+
+// highlightCmd 处理 /highlight [-line] 样式 正则 命令，正则中可以包含空格
+func (c *Client) highlightCmd(args []string) {
+	action := rules.ActionMatch
+	if len(args) > 0 && args[0] == "-line" {
+		action = rules.ActionLine
+		args = args[1:]
+	}
+
+	if len(args) < 2 {
+		c.ui.Println("用法: /highlight [-line] 前景色[:背景色[:属性]] 正则")
+		return
+	}
+
+	c.addRule(rules.Rule{
+		Pattern: strings.Join(args[1:], " "),
+		Action:  action,
+		Style:   args[0],
+	})
+}
+
+// gagCmd 处理 /gag 正则 命令，匹配的行不再显示，但仍会记录到日志中
+func (c *Client) gagCmd(args []string) {
+	if len(args) == 0 {
+		c.ui.Println("用法: /gag 正则")
+		return
+	}
+
+	c.addRule(rules.Rule{
+		Pattern: strings.Join(args, " "),
+		Action:  rules.ActionGag,
+	})
+}
+
+func (c *Client) addRule(rule rules.Rule) {
+	if err := c.rules.Add(rule); err != nil {
+		c.ui.Printf("规则有误: %v\n", err)
+		return
+	}
+
+	c.ui.Printf("已添加规则: %s\n", rule)
+}
+
+// rulesCmd 处理 /rules [del N|clear] 命令，不带参数时列出所有规则
+func (c *Client) rulesCmd(args []string) {
+	switch {
+	case len(args) == 0:
+		list := c.rules.List()
+		if len(list) == 0 {
+			c.ui.Println("目前没有任何规则。")
+		}
+		for i, rule := range list {
+			c.ui.Printf("%3d %s\n", i+1, rule)
+		}
+	case args[0] == "clear":
+		c.rules.Clear()
+		c.ui.Println("已删除所有规则。")
+	case args[0] == "del" && len(args) == 2:
+		i, err := strconv.Atoi(args[1])
+		if err == nil {
+			err = c.rules.Delete(i)
+		}
+		if err != nil {
+			c.ui.Printf("/rules: %v\n", err)
+		}
+	default:
+		c.ui.Println("用法: /rules [del N|clear]")
+	}
+}
+
+// timersCmd 处理 /timers [pause|resume|del id] 命令，不带参数时列出所有定时器
+func (c *Client) timersCmd(args []string) {
+	if len(args) == 0 {
+		timers := c.lua.Timers()
+		if len(timers) == 0 {
+			c.ui.Println("目前没有定时器。")
+		}
+		for _, t := range timers {
+			c.ui.Println(t)
+		}
+		return
+	}
+
+	if len(args) != 2 {
+		c.ui.Println("用法: /timers [pause|resume|del id]")
+		return
+	}
+
+	ok := false
+	id := args[1]
+	switch args[0] {
+	case "pause":
+		ok = c.lua.PauseTimer(id, true)
+	case "resume":
+		ok = c.lua.PauseTimer(id, false)
+	case "del":
+		ok = c.lua.DelTimer(id)
+	default:
+		c.ui.Println("用法: /timers [pause|resume|del id]")
+		return
+	}
+
+	if !ok {
+		c.ui.Printf("/timers: 定时器 %s 不存在\n", id)
+	}
+}
+
+// luaCmd 处理 /lua errors [n|clear] 命令，列出最近的 Lua 错误、查看第 n 个错误的调用栈或者清空错误列表
+func (c *Client) luaCmd(args []string) {
+	if len(args) == 0 || args[0] != "errors" || len(args) > 2 {
+		c.ui.Println("用法: /lua errors [n|clear]")
+		return
+	}
+
+	if len(args) == 1 {
+		errors := c.lua.Errors()
+		if len(errors) == 0 {
+			c.ui.Println("最近没有 Lua 错误。")
+		}
+		for i, e := range errors {
+			c.ui.Printf("%3d. %s\n", i+1, e)
+		}
+		return
+	}
+
+	if args[1] == "clear" {
+		c.lua.ClearErrors()
+		c.ui.Println("已清空 Lua 错误列表。")
+		return
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		c.ui.Println("用法: /lua errors [n|clear]")
+		return
+	}
+	detail, ok := c.lua.ErrorDetail(n)
+	if !ok {
+		c.ui.Printf("/lua: 第 %d 个错误不存在\n", n)
+		return
+	}
+	c.ui.Println(detail)
+}
+
+// pluginCmd 处理 /plugin [reload|enable|disable name] 命令，不带参数时列出所有插件
+func (c *Client) pluginCmd(args []string) {
+	if len(args) == 0 {
+		plugins := c.lua.Plugins()
+		if len(plugins) == 0 {
+			c.ui.Println("目前没有插件。")
+		}
+		for _, p := range plugins {
+			c.ui.Println(p)
+		}
+		return
+	}
+
+	if len(args) != 2 {
+		c.ui.Println("用法: /plugin [reload|enable|disable name]")
+		return
+	}
+
+	var err error
+	name := args[1]
+	switch args[0] {
+	case "reload", "enable":
+		err = c.lua.ReloadPlugin(name)
+	case "disable":
+		if err = c.lua.DisablePlugin(name); err == nil {
+			c.ui.Printf("插件 %s 已禁用。\n", name)
+		}
+	default:
+		c.ui.Println("用法: /plugin [reload|enable|disable name]")
+		return
+	}
+
+	if err != nil {
+		c.ui.Printf("/plugin: %v\n", err)
+	}
+}
@@ -5,12 +5,15 @@ go 1.13
 require (
 	github.com/flw-cn/go-smartConfig v1.1.3
 	github.com/flw-cn/printer v0.0.0-20190906044932-ecdb12812e08
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/gdamore/tcell v1.3.0
 	github.com/mattn/go-runewidth v0.0.4
 	github.com/rivo/tview v0.0.0-20190829161255-f8bc69b90341
 	github.com/spf13/cobra v0.0.5
+	github.com/spf13/viper v1.6.2
 	github.com/yuin/gopher-lua v0.0.0-20190514113301-1cd887cd7036
 	golang.org/x/text v0.3.2
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 replace github.com/rivo/tview v0.0.0-20190829161255-f8bc69b90341 => github.com/dzpao/tview v0.0.0-20200122091015-7e3eb050fe6b
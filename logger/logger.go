@@ -0,0 +1,364 @@
+// Package logger 把会话内容记录到日志文件中，支持纯文本、ANSI 及 HTML 三种格式。
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flw-cn/printer"
+
+	"github.com/mudclient/go-mud/ansi"
+)
+
+type Config struct {
+	Enable    bool   `flag:"|false|是否在启动时自动开始记录日志"`
+	File      string `flag:"|log/{server}-{date}.log|日志文件名模板，可以使用 server、port、date、time 变量，变量名写在花括号中"`
+	Format    string `flag:"|plain|日志格式，可选值: plain/ansi/html"`
+	Timestamp bool   `flag:"|false|是否在每行日志前加上时间戳"`
+	Rotate    bool   `flag:"|true|是否每天更换一个日志文件"`
+}
+
+const (
+	FormatPlain = "plain"
+	FormatANSI  = "ansi"
+	FormatHTML  = "html"
+)
+
+const htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { background: #000000; color: #c7c7c7; font-family: monospace; white-space: pre-wrap; }
+.ts { color: #7f7f7f; }
+.mark { color: #ffff00; }
+</style>
+</head>
+<body>
+`
+
+const htmlFooter = "</body>\n</html>\n"
+
+var errNotRunning = errors.New("日志记录尚未开始")
+
+type Logger struct {
+	config Config
+	host   string
+	port   int
+	screen printer.Printer
+
+	mu     sync.Mutex
+	file   *os.File
+	name   string
+	format string
+	day    string
+	style  ansi.Style
+}
+
+func NewLogger(config Config, host string, port int) *Logger {
+	return &Logger{
+		config: config,
+		host:   host,
+		port:   port,
+		format: normalizeFormat(config.Format),
+		screen: printer.NewSimplePrinter(os.Stdout),
+	}
+}
+
+// SetScreen 设置显示错误信息的地方
+func (l *Logger) SetScreen(w printer.Printer) {
+	l.screen = w
+}
+
+func normalizeFormat(format string) string {
+	switch strings.ToLower(format) {
+	case FormatANSI:
+		return FormatANSI
+	case FormatHTML:
+		return FormatHTML
+	default:
+		return FormatPlain
+	}
+}
+
+// Init 根据配置决定是否立即开始记录日志
+func (l *Logger) Init() error {
+	if !l.config.Enable {
+		return nil
+	}
+
+	return l.Start("")
+}
+
+// Start 开始记录日志，format 为空时使用配置中的格式
+func (l *Logger) Start(format string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		l.close()
+	}
+
+	if format != "" {
+		l.format = normalizeFormat(format)
+	}
+
+	return l.open(time.Now())
+}
+
+// Stop 停止记录日志
+func (l *Logger) Stop() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return errNotRunning
+	}
+
+	return l.close()
+}
+
+// Running 返回日志是否正在记录，以及日志文件名
+func (l *Logger) Running() (bool, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file != nil, l.name
+}
+
+// Mark 在日志中写入一个醒目的标记，便于日后查找
+func (l *Logger) Mark(note string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return errNotRunning
+	}
+
+	now := time.Now()
+	text := fmt.Sprintf("======== %s %s ========", now.Format("2006-01-02 15:04:05"), note)
+	if l.format == FormatHTML {
+		_, err := fmt.Fprintf(l.file, "<span class=\"mark\">%s</span>\n", html.EscapeString(text))
+		return err
+	}
+
+	_, err := fmt.Fprintln(l.file, text)
+	return err
+}
+
+// Println 记录一行内容，line 中可以包含 ANSI 控制码
+func (l *Logger) Println(line string) {
+	l.LogLine(time.Now(), line)
+}
+
+// LogLine 以指定的时间记录一行内容
+func (l *Logger) LogLine(t time.Time, line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return
+	}
+
+	if l.config.Rotate && t.Format("2006-01-02") != l.day {
+		l.close()
+		if err := l.open(t); err != nil {
+			l.screen.Printf("无法打开新的日志文件，日志记录已停止: %v\n", err)
+			return
+		}
+	}
+
+	var ts string
+	if l.config.Timestamp {
+		ts = t.Format("[15:04:05] ")
+	}
+
+	switch l.format {
+	case FormatANSI:
+		fmt.Fprintf(l.file, "%s%s\n", ts, line)
+	case FormatHTML:
+		if ts != "" {
+			fmt.Fprintf(l.file, "<span class=\"ts\">%s</span>", ts)
+		}
+		l.writeHTML(l.file, line)
+	default:
+		fmt.Fprintf(l.file, "%s%s\n", ts, ansi.Strip(line))
+	}
+}
+
+// writeHTML 把带有 ANSI 控制码的一行转换为 HTML 写入 w，颜色转换为 CSS 样式
+func (l *Logger) writeHTML(w io.Writer, line string) {
+	var segments []ansi.Segment
+	segments, l.style = ansi.Parse(line, l.style)
+
+	var b strings.Builder
+	for _, seg := range segments {
+		css := styleCSS(seg.Style)
+		text := html.EscapeString(seg.Text)
+		if css == "" {
+			b.WriteString(text)
+		} else {
+			fmt.Fprintf(&b, "<span style=\"%s\">%s</span>", css, text)
+		}
+	}
+	b.WriteString("\n")
+
+	io.WriteString(w, b.String())
+}
+
+func styleCSS(style ansi.Style) string {
+	fg := style.EffectiveFg().Hex(&ansi.DefaultPalette)
+	bg := style.Bg.Hex(&ansi.DefaultPalette)
+	if style.Reverse {
+		if fg == "" {
+			fg = "#c7c7c7"
+		}
+		if bg == "" {
+			bg = "#000000"
+		}
+		fg, bg = bg, fg
+	}
+
+	var css []string
+	if fg != "" {
+		css = append(css, "color: "+fg)
+	}
+	if bg != "" {
+		css = append(css, "background: "+bg)
+	}
+	if style.Bold {
+		css = append(css, "font-weight: bold")
+	}
+	if style.Dim {
+		css = append(css, "opacity: 0.6")
+	}
+	if style.Italic {
+		css = append(css, "font-style: italic")
+	}
+
+	var decorations []string
+	if style.Underline {
+		decorations = append(decorations, "underline")
+	}
+	if style.Strike {
+		decorations = append(decorations, "line-through")
+	}
+	if style.Blink {
+		decorations = append(decorations, "blink")
+	}
+	if len(decorations) > 0 {
+		css = append(css, "text-decoration: "+strings.Join(decorations, " "))
+	}
+
+	return strings.Join(css, "; ")
+}
+
+// fileName 根据模板生成日志文件名
+func (l *Logger) fileName(t time.Time) string {
+	name := l.config.File
+	if name == "" {
+		name = "log/{server}-{date}.log"
+	}
+
+	// 需要按天更换日志文件而模板中又没有日期时，在扩展名之前加上日期
+	if l.config.Rotate && !strings.Contains(name, "{date}") {
+		ext := filepath.Ext(name)
+		name = strings.TrimSuffix(name, ext) + "-{date}" + ext
+	}
+
+	if l.format == FormatHTML && filepath.Ext(name) == ".log" {
+		name = strings.TrimSuffix(name, ".log") + ".html"
+	}
+
+	replacer := strings.NewReplacer(
+		"{server}", l.host,
+		"{port}", strconv.Itoa(l.port),
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("150405"),
+	)
+
+	return replacer.Replace(name)
+}
+
+// open 打开日志文件，调用者需持有锁
+func (l *Logger) open(t time.Time) error {
+	name := l.fileName(t)
+	if dir := filepath.Dir(name); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	if l.format == FormatHTML {
+		err = continueHTML(file, l.host)
+	} else {
+		_, err = file.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.name = name
+	l.day = t.Format("2006-01-02")
+	l.style = ansi.Style{}
+
+	return nil
+}
+
+// continueHTML 准备在 HTML 日志文件的末尾继续记录：新文件写入文件头，
+// 已有的文件去掉上次关闭时写入的文件尾，这样同一个文件中始终只有一个完整的 HTML 文档
+func continueHTML(file *os.File, host string) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := info.Size()
+	if size == 0 {
+		_, err = fmt.Fprintf(file, htmlHeader, html.EscapeString(host))
+		return err
+	}
+
+	if size >= int64(len(htmlFooter)) {
+		tail := make([]byte, len(htmlFooter))
+		if _, err = file.ReadAt(tail, size-int64(len(htmlFooter))); err != nil {
+			return err
+		}
+		if string(tail) == htmlFooter {
+			size -= int64(len(htmlFooter))
+			if err = file.Truncate(size); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = file.Seek(size, io.SeekStart)
+	return err
+}
+
+// close 关闭日志文件，调用者需持有锁
+func (l *Logger) close() error {
+	if l.format == FormatHTML {
+		io.WriteString(l.file, htmlFooter)
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
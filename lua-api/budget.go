@@ -0,0 +1,209 @@
+package lua
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// 每处理一个事件（收到一行、发送命令、定时器触发等）都会给 Lua 环境设置一个新的 context，
+// 执行时间超过 Lua.Timeout 或者内存增长超过 Lua.MemoryLimit 时取消它，Lua 虚拟机在执行下一条指令时就会出错返回，
+// 这样死循环的脚本不会让整个客户端失去响应。
+// 读取堆内存需要暂停整个程序，所以 watchdog 只在 Lua 正在执行时检查，并以第一次检查时的堆内存为基准，
+// 很快结束的调用不会读取堆内存。
+
+const memoryCheckInterval = 100 * time.Millisecond
+
+// budget 是当前事件的资源预算，watchdog 在另一个 goroutine 中访问，所以需要加锁
+type budget struct {
+	sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	timer  *time.Timer
+	heap   uint64 // watchdog 第一次检查时的堆内存，0 表示还没有检查过
+	reason string // 被中止的原因
+}
+
+func (api *API) limited() bool {
+	return api.config.Timeout > 0 || api.config.MemoryLimit > 0
+}
+
+// begin 为即将处理的事件设置资源预算
+func (api *API) begin() {
+	if !api.limited() {
+		return
+	}
+
+	b := &api.budget
+	b.Lock()
+	defer b.Unlock()
+
+	// 事件中创建的协程会继承这个 context，但协程之后恢复时会通过 bindThread 换成新事件的 context，
+	// 所以事件结束时可以放心地取消它
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	b.reason = ""
+	if api.config.Timeout > 0 {
+		timeout := time.Duration(api.config.Timeout) * time.Millisecond
+		ctx := b.ctx
+		b.timer = time.AfterFunc(timeout, func() {
+			api.abort(ctx, fmt.Sprintf("执行时间超过 %v", timeout))
+		})
+	}
+	b.heap = 0
+
+	if api.lstate != nil {
+		api.lstate.SetContext(b.ctx)
+	}
+}
+
+// end 在事件处理完之后取消资源预算
+func (api *API) end() {
+	if !api.limited() {
+		return
+	}
+
+	b := &api.budget
+	b.Lock()
+	defer b.Unlock()
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.cancel != nil {
+		b.cancel()
+		b.cancel = nil
+	}
+	b.ctx = nil
+
+	if api.lstate != nil {
+		api.lstate.RemoveContext()
+	}
+}
+
+// eventContext 返回当前事件的 context，没有资源限制或者不在处理事件时返回 nil
+func (api *API) eventContext() context.Context {
+	b := &api.budget
+	b.Lock()
+	defer b.Unlock()
+
+	return b.ctx
+}
+
+// abort 以 reason 为原因中止 ctx 对应的事件，事件已经结束时什么也不做
+func (api *API) abort(ctx context.Context, reason string) {
+	b := &api.budget
+	b.Lock()
+	defer b.Unlock()
+
+	if b.ctx != ctx || b.reason != "" {
+		return
+	}
+
+	b.reason = reason
+	b.cancel()
+}
+
+// abortReason 把错误信息中 context 被取消的提示替换为更清楚的说明
+func (api *API) abortReason(message string) string {
+	b := &api.budget
+	b.Lock()
+	defer b.Unlock()
+
+	if b.reason == "" {
+		return message
+	}
+
+	return strings.Replace(message, context.Canceled.Error(), b.reason+"，已被中止", 1)
+}
+
+// bindThread 让协程 th 使用当前事件的资源预算，协程可能是在之前的事件中创建的
+func (api *API) bindThread(th *lua.LState) {
+	if !api.limited() {
+		return
+	}
+
+	if ctx := api.eventContext(); ctx != nil {
+		th.SetContext(ctx)
+	} else {
+		th.RemoveContext()
+	}
+}
+
+// hookCoroutine 让 coroutine.resume 恢复的协程使用当前事件的资源预算
+func (api *API) hookCoroutine() {
+	l := api.lstate
+
+	co, ok := l.GetGlobal("coroutine").(*lua.LTable)
+	if !ok {
+		return
+	}
+	resume, ok := co.RawGetString("resume").(*lua.LFunction)
+	if !ok {
+		return
+	}
+
+	co.RawSetString("resume", l.NewFunction(func(l *lua.LState) int {
+		api.bindThread(l.CheckThread(1))
+
+		n := l.GetTop()
+		l.Insert(resume, 1)
+		l.Call(n, lua.MultRet)
+		return l.GetTop()
+	}))
+}
+
+// watchdog 定期检查内存，当前事件的内存增长超过 Lua.MemoryLimit 时中止它
+func (api *API) watchdog() {
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			api.checkMemory()
+		case <-api.quit:
+			return
+		}
+	}
+}
+
+// checkMemory 检查当前事件的内存增长，没有正在执行的事件时什么也不做
+func (api *API) checkMemory() {
+	b := &api.budget
+	b.Lock()
+	ctx, heap := b.ctx, b.heap
+	b.Unlock()
+
+	if ctx == nil {
+		return
+	}
+
+	current := heapAlloc()
+	if heap == 0 {
+		b.Lock()
+		if b.ctx == ctx {
+			b.heap = current
+		}
+		b.Unlock()
+		return
+	}
+
+	if current > heap+uint64(api.config.MemoryLimit)<<20 {
+		api.abort(ctx, fmt.Sprintf("内存增长超过 %d MB", api.config.MemoryLimit))
+	}
+}
+
+// heapAlloc 返回整个程序的堆内存，gopher-lua 没有单独统计 Lua 的内存，
+// 所以内存限制只是一个估算，其它 goroutine 同时分配的内存也会计算在内
+func heapAlloc() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
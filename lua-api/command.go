@@ -0,0 +1,55 @@
+package lua
+
+import (
+	"fmt"
+)
+
+// Lua 脚本通过 Run 执行的命令交给主程序，与用户输入的命令经过同样的处理。
+// 主程序执行命令时会调用 OnSend 钩子，钩子中可能再次调用 Run，所以命令不能在 Lua 的 goroutine 中同步执行，
+// 只能放入队列，并记录嵌套的层数，以免别名等相互调用造成无限循环。
+// Send 发送的命令也放入同一个队列，这样 Run 和 Send 混合使用时，命令到达服务器的顺序与调用的顺序相同。
+
+const (
+	commandQueueSize = 256
+	maxCommandDepth  = 10
+)
+
+// Command 是 Lua 脚本通过 Run 或 Send 执行的命令，Depth 为嵌套的层数，
+// 在 OnSend 钩子中调用 Run 得到的命令比钩子所处理的命令多一层。
+// Raw 为 true 表示命令来自 Send，应该原样发送给服务器
+type Command struct {
+	Text  string
+	Depth int
+	Raw   bool
+}
+
+// Commands 返回 Lua 脚本通过 Run 或 Send 执行的命令的通道，主程序应该像处理用户输入一样处理 Run 的命令，
+// 并在调用 OnSend 时传入命令的 Depth，Send 的命令则直接发送给服务器
+func (api *API) Commands() <-chan Command {
+	return api.commands
+}
+
+// queueCommand 把 text 放入命令队列，嵌套过深或者队列已满时返回错误，只能在执行 Lua 的 goroutine 中调用
+func (api *API) queueCommand(text string) error {
+	depth := api.sendDepth + 1
+	if depth > maxCommandDepth {
+		return fmt.Errorf("Run 嵌套超过 %d 层，可能是别名之间相互调用：%s", maxCommandDepth, text)
+	}
+
+	return api.pushCommand(Command{Text: text, Depth: depth}, "Run")
+}
+
+// queueRaw 把 Send 的 text 放入命令队列，队列已满时返回错误，只能在执行 Lua 的 goroutine 中调用
+func (api *API) queueRaw(text string) error {
+	return api.pushCommand(Command{Text: text, Raw: true}, "Send")
+}
+
+// pushCommand 把 cmd 放入命令队列，队列已满时返回错误，name 为调用者在 Lua 中的名称
+func (api *API) pushCommand(cmd Command, name string) error {
+	select {
+	case api.commands <- cmd:
+		return nil
+	default:
+		return fmt.Errorf("%s 的命令过多，来不及执行：%s", name, cmd.Text)
+	}
+}
@@ -0,0 +1,87 @@
+package lua
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mudclient/go-mud/ansi"
+)
+
+// defaultEchoColors 是 Echo 中 $XXX$ 颜色代码的默认样式，与 MUD 服务器常用的 ANSI 颜色宏一致，
+// 样式的格式为 "前景色:背景色:属性"，NOR 表示恢复默认显示属性
+var defaultEchoColors = map[string]string{
+	"BLK": "black", "RED": "red", "GRN": "green", "YEL": "yellow",
+	"BLU": "blue", "MAG": "magenta", "CYN": "cyan", "WHT": "white",
+	"HIK": "black::b", "HIR": "red::b", "HIG": "green::b", "HIY": "yellow::b",
+	"HIB": "blue::b", "HIM": "magenta::b", "HIC": "cyan::b", "HIW": "white::b",
+	"BBLK": ":black", "BRED": ":red", "BGRN": ":green", "BYEL": ":yellow",
+	"BBLU": ":blue", "BMAG": ":magenta", "BCYN": ":cyan", "BWHT": ":white",
+	"HBRED": ":hired", "HBGRN": ":higreen", "HBYEL": ":hiyellow", "HBBLU": ":hiblue",
+	"HBMAG": ":himagenta", "HBCYN": ":hicyan", "HBWHT": ":hiwhite",
+	"BNK": "::l", "REV": "::r", "U": "::u", "BOLD": "::b",
+}
+
+// echoCodeRe 匹配 $XXX$、$#rrggbb$ 以及 $bg:颜色$ 形式的颜色代码
+var echoCodeRe = regexp.MustCompile(`\$([A-Z]+|#[0-9A-Fa-f]{6}|bg:[#\w]+)\$`)
+
+// loadEchoColors 把默认颜色表与配置中的颜色表合并，转换为 SGR 控制序列，
+// 返回配置有误的颜色代码及其错误
+func (api *API) loadEchoColors() map[string]error {
+	colors := map[string]string{}
+	for code, spec := range defaultEchoColors {
+		colors[code] = spec
+	}
+	for code, spec := range api.config.Colors {
+		colors[strings.ToUpper(code)] = spec
+	}
+
+	errs := map[string]error{}
+	api.echoCodes = map[string]string{"NOR": "\x1b[0m"}
+	for code, spec := range colors {
+		style, err := ansi.ParseStyle(spec)
+		if err != nil {
+			errs[code] = err
+			continue
+		}
+		api.echoCodes[code] = style.Overlay()
+	}
+
+	return errs
+}
+
+// echoToANSI 把 text 中的颜色代码转换为 ANSI 控制码，未知的代码保持原样，
+// 用过颜色代码时在行尾恢复默认显示属性，以免影响后面的内容
+func (api *API) echoToANSI(text string) string {
+	changed := false
+	text = echoCodeRe.ReplaceAllStringFunc(text, func(match string) string {
+		code := match[1 : len(match)-1]
+
+		var style ansi.Style
+		switch {
+		case strings.HasPrefix(code, "#"):
+			style.Fg, _ = ansi.ParseColor(code)
+		case strings.HasPrefix(code, "bg:"):
+			c, err := ansi.ParseColor(code[3:])
+			if err != nil {
+				return match
+			}
+			style.Bg = c
+		default:
+			sgr, ok := api.echoCodes[code]
+			if !ok {
+				return match
+			}
+			changed = true
+			return sgr
+		}
+
+		changed = true
+		return style.Overlay()
+	})
+
+	if changed {
+		text += "\x1b[0m"
+	}
+
+	return text
+}
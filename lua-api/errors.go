@@ -0,0 +1,141 @@
+package lua
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Lua 脚本出错时显示错误信息及调用栈，并记录在最近的错误列表中，可以通过 /lua errors 查看。
+// 每收到一行都会执行的钩子出错时往往会反复出现同样的错误，所以同样的错误在一段时间内只显示一次。
+
+const (
+	errorHistorySize = 100
+	errorInterval    = 10 * time.Second
+)
+
+// luaError 是最近出现过的一种错误，相同错误信息的错误只记录一次
+type luaError struct {
+	message   string
+	traceback string
+	first     time.Time
+	last      time.Time
+	count     int
+
+	shown      time.Time // 上一次显示的时间
+	suppressed int       // 上一次显示之后没有显示的次数
+}
+
+// String 返回错误的概要，用于 /lua errors 列表
+func (e *luaError) String() string {
+	s := fmt.Sprintf("%s %s", e.last.Format("15:04:05"), e.message)
+	if e.count > 1 {
+		s += fmt.Sprintf(" (共 %d 次，首次出现于 %s)", e.count, e.first.Format("15:04:05"))
+	}
+
+	return s
+}
+
+// splitError 把错误分为错误信息和调用栈两部分，错误信息中通常包含出错的文件名和行号
+func splitError(err error) (message, traceback string) {
+	if e, ok := err.(*lua.ApiError); ok {
+		return e.Object.String(), e.StackTrace
+	}
+
+	s := err.Error()
+	if i := strings.Index(s, "\n"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+
+	return s, ""
+}
+
+// Panic 显示并记录 Lua 错误，同样的错误在 errorInterval 之内只显示一次
+func (api *API) Panic(err error) {
+	message, traceback := splitError(err)
+	message = api.abortReason(message)
+	now := time.Now()
+
+	var e *luaError
+	for i, v := range api.errors {
+		if v.message == message {
+			e = v
+			// 移到最后，列表总是按最近出现的时间排列
+			api.errors = append(append(api.errors[:i:i], api.errors[i+1:]...), e)
+			break
+		}
+	}
+
+	if e == nil {
+		e = &luaError{message: message, first: now}
+		api.errors = append(api.errors, e)
+		if len(api.errors) > errorHistorySize {
+			api.errors = api.errors[len(api.errors)-errorHistorySize:]
+		}
+	}
+
+	e.traceback = traceback
+	e.last = now
+	e.count++
+
+	if now.Sub(e.shown) < errorInterval {
+		e.suppressed++
+		return
+	}
+
+	api.screen.Printf("Lua error: %s\n", message)
+	if e.count == 1 && traceback != "" {
+		api.screen.Println(indent(traceback))
+	}
+	if e.suppressed > 0 {
+		api.screen.Printf("（此错误在此之前又出现了 %d 次，已省略，可通过 /lua errors 查看）\n", e.suppressed)
+	}
+
+	e.shown = now
+	e.suppressed = 0
+}
+
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n    ")
+}
+
+// Errors 返回最近出现的错误的概要，最近出现的排在最后
+func (api *API) Errors() []string {
+	var list []string
+	api.call(func() {
+		for _, e := range api.errors {
+			list = append(list, e.String())
+		}
+	})
+
+	return list
+}
+
+// ErrorDetail 返回 Errors 中第 n 个（从 1 开始）错误的错误信息和调用栈
+func (api *API) ErrorDetail(n int) (string, bool) {
+	var detail string
+	ok := false
+	api.call(func() {
+		if n < 1 || n > len(api.errors) {
+			return
+		}
+
+		e := api.errors[n-1]
+		detail = e.String()
+		if e.traceback != "" {
+			detail += "\n" + indent(e.traceback)
+		}
+		ok = true
+	})
+
+	return detail, ok
+}
+
+// ClearErrors 清空最近出现的错误
+func (api *API) ClearErrors() {
+	api.call(func() {
+		api.errors = nil
+	})
+}
@@ -0,0 +1,113 @@
+package lua
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+// 事件总线：Lua 中可以通过 On(event, fn) 为同一个事件注册多个监听函数，通过 Emit 发出自定义事件。
+// Go 这边会发出 receive、send、prompt、connect、disconnect、gmcp、resize、keypress、timer、reload、quit 等事件。
+
+// emit 依次以 args 调用 event 的所有监听函数，l 为当前正在运行的 Lua 环境。
+// 某个监听函数出错不影响其它监听函数，有监听函数返回 false 时返回 false。
+func (api *API) emit(l *lua.LState, event string, args ...lua.LValue) bool {
+	if l == nil {
+		return true
+	}
+
+	result := true
+	// 监听函数中可能会注册或者注销监听函数，所以先复制一份
+	listeners := append([]*lua.LFunction(nil), api.listeners[event]...)
+	for _, fn := range listeners {
+		err := l.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...)
+		if err != nil {
+			api.Panic(err)
+			continue
+		}
+
+		if l.Get(-1) == lua.LFalse {
+			result = false
+		}
+		l.Pop(1)
+	}
+
+	return result
+}
+
+// Emit 在 Lua 环境中发出事件，不等待其执行，args 可以是字符串、整数、浮点数或者布尔值
+func (api *API) Emit(event string, args ...interface{}) {
+	values := make([]lua.LValue, 0, len(args))
+	for _, arg := range args {
+		values = append(values, toLValue(arg))
+	}
+
+	api.post(func() {
+		api.emit(api.lstate, event, values...)
+	})
+}
+
+func toLValue(v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return lua.LNil
+	case string:
+		return lua.LString(v)
+	case bool:
+		return lua.LBool(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case lua.LValue:
+		return v
+	default:
+		return lua.LNil
+	}
+}
+
+// LuaOn 对应 Lua 中的 On(event, fn)，为 event 注册监听函数，返回 fn 以便之后注销
+func (api *API) LuaOn(l *lua.LState) int {
+	event := l.CheckString(1)
+	fn := l.CheckFunction(2)
+
+	api.listeners[event] = append(api.listeners[event], fn)
+
+	l.Push(fn)
+	return 1
+}
+
+// LuaOff 对应 Lua 中的 Off(event, [fn])，注销 event 的监听函数 fn，省略 fn 时注销所有监听函数
+func (api *API) LuaOff(l *lua.LState) int {
+	event := l.CheckString(1)
+	fn := l.OptFunction(2, nil)
+
+	if fn == nil {
+		delete(api.listeners, event)
+		return 0
+	}
+
+	listeners := api.listeners[event][:0:0]
+	for _, f := range api.listeners[event] {
+		if f != fn {
+			listeners = append(listeners, f)
+		}
+	}
+	api.listeners[event] = listeners
+
+	return 0
+}
+
+// LuaEmit 对应 Lua 中的 Emit(event, ...)，立即以其余参数调用 event 的所有监听函数，
+// 有监听函数返回 false 时返回 false
+func (api *API) LuaEmit(l *lua.LState) int {
+	event := l.CheckString(1)
+
+	var args []lua.LValue
+	for i := 2; i <= l.GetTop(); i++ {
+		args = append(args, l.Get(i))
+	}
+
+	l.Push(lua.LBool(api.emit(l, event, args...)))
+	return 1
+}
@@ -0,0 +1,72 @@
+package lua
+
+// gopher-lua 不是并发安全的，所以所有对 Lua 环境的调用（接收、发送、定时器、重新加载等）
+// 都放入同一个事件队列，由一个专门的 goroutine 按顺序执行。
+// 在这个 goroutine 中执行的代码（包括 Lua 调用的 Go 函数）不能再使用 call，否则会死锁。
+
+const eventQueueSize = 1024
+
+// run 依次执行事件队列中的函数，直到 Stop 被调用
+func (api *API) run() {
+	for {
+		select {
+		case fn := <-api.events:
+			api.begin()
+			fn()
+			for len(api.deferred) > 0 {
+				fn, api.deferred = api.deferred[0], api.deferred[1:]
+				fn()
+			}
+			api.end()
+		case <-api.quit:
+			return
+		}
+	}
+}
+
+// later 让 fn 在当前事件处理完之后执行，只能在执行 Lua 的 goroutine 中调用
+func (api *API) later(fn func()) {
+	api.deferred = append(api.deferred, fn)
+}
+
+// post 把 fn 放入事件队列，不等待其执行
+func (api *API) post(fn func()) {
+	select {
+	case api.events <- fn:
+	case <-api.quit:
+	}
+}
+
+// call 把 fn 放入事件队列，并等待其执行完毕
+func (api *API) call(fn func()) {
+	done := make(chan struct{})
+	api.post(func() {
+		defer close(done)
+		fn()
+	})
+
+	select {
+	case <-done:
+	case <-api.quit:
+	}
+}
+
+// Stop 关闭 Lua 环境并结束事件队列，之后的调用都会被忽略
+func (api *API) Stop() {
+	api.call(func() {
+		api.emit(api.lstate, "quit")
+		api.clearTimers()
+		api.clearWaiters()
+		if api.lstate != nil {
+			api.lstate.Close()
+			api.lstate = nil
+		}
+		close(api.quit)
+	})
+
+	if api.store != nil {
+		if err := api.store.Flush(); err != nil {
+			api.screen.Printf("无法写入持久化存储: %v\n", err)
+		}
+	}
+}
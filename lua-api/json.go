@@ -0,0 +1,53 @@
+package lua
+
+import (
+	"bytes"
+	"encoding/json"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// LuaJSONEncode 对应 Lua 中的 json.encode(value, [indent])，把 value 编码为 JSON 字符串，
+// indent 为 true 时输出缩进格式。从 1 开始连续编号的表编码为数组，空表也编码为数组。
+func (api *API) LuaJSONEncode(l *lua.LState) int {
+	value, err := toGo(l.CheckAny(1))
+	if err != nil {
+		l.ArgError(1, err.Error())
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if l.OptBool(2, false) {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(value); err != nil {
+		l.RaiseError("%v", err)
+	}
+
+	l.Push(lua.LString(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))))
+	return 1
+}
+
+// LuaJSONDecode 对应 Lua 中的 json.decode(s)，返回解码得到的值，出错时返回 nil 和错误信息，
+// JSON 中的 null 解码为 nil
+func (api *API) LuaJSONDecode(l *lua.LState) int {
+	var value interface{}
+	if err := json.Unmarshal([]byte(l.CheckString(1)), &value); err != nil {
+		l.Push(lua.LNil)
+		l.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	l.Push(fromGo(l, value))
+	return 1
+}
+
+func (api *API) registerJSON() {
+	l := api.lstate
+
+	l.SetGlobal("json", l.SetFuncs(l.NewTable(), map[string]lua.LGFunction{
+		"encode": api.LuaJSONEncode,
+		"decode": api.LuaJSONDecode,
+	}))
+}
@@ -1,75 +1,200 @@
 package lua
 
 import (
-	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path"
 	"regexp"
-	"sync"
-	"time"
+	"strings"
 
 	"github.com/flw-cn/printer"
 	lua "github.com/yuin/gopher-lua"
-)
 
-var errPanic = errors.New("LUA Panic")
+	"github.com/mudclient/go-mud/ansi"
+)
 
 type Config struct {
-	Enable bool   `flag:"|true|是否加载 Lua 机器人"`
-	Path   string `flag:"p|lua|Lua 插件路径 {path}"`
+	Enable      bool   `flag:"|true|是否加载 Lua 机器人"`
+	Path        string `flag:"p|lua|Lua 插件路径 {path}"`
+	Watch       bool   `flag:"|false|Lua 脚本有变化时是否自动重新加载"`
+	Sandbox     bool   `flag:"|false|是否在沙箱中运行 Lua 脚本，禁止访问文件和操作系统"`
+	Timeout     int    `flag:"|0|每次调用 Lua 的最长执行时间（毫秒），0 表示不限制"`
+	MemoryLimit int    `flag:"|0|每次调用 Lua 时允许增加的内存（MB），0 表示不限制"`
+	Store       string `flag:"|data/{server}-{port}.json|Lua 持久化存储文件名模板，相对于配置文件所在的目录，可以使用 server、port 变量，变量名写在花括号中"`
+	Character   string `flag:"||持久化存储使用的角色名，留空时使用第一次输入密码前输入的 ID"`
+
+	TimerHandler    string `flag:"|call_timer_actions|定时器的动作为代码时，优先交给这个 Lua 全局函数处理"`
+	DisabledPlugins string `flag:"||不加载的插件，多个插件用逗号分隔"`
+
+	// Colors 为 Echo 中 $XXX$ 颜色代码的样式，会覆盖同名的默认样式
+	Colors map[string]string
+}
+
+// UI 是 Lua 环境可以操作的用户界面功能
+type UI interface {
+	SetCompletions(source string, words []string)
+	BindKey(key, binding string) error
+	CaptureTo(name, line string) error
+	SetStatus(name, text, color string, line int)
+	SetGauge(name string, cur, max int, text, color string, width, line int)
+	DelStatus(name string)
+
+	GetInput() string
+	SetInput(text string)
+	InsertInput(text string)
+	Lines(n int) []string
+	OpenWindow(name, position string, size int) error
+	CloseWindow(name string) error
+	ShowWindow(name string, show bool) error
+	ClearWindow(name string) error
+	RunAction(name string) error
+	Search(pattern string, backward bool) error
+	ShowMenu(title string, items []string, done func(index int))
+	ShowPrompt(title, text string, done func(text string, ok bool))
 }
 
 type API struct {
 	config Config
 
 	screen printer.Printer
-	mud    io.Writer
+	ui     UI
+
+	echoCodes map[string]string
+	regexps   map[string]*regexp.Regexp
+
+	store     *Store
+	storeErr  error
+	configDir string
+	host      string
+	port      int
+
+	characterKnown bool   // 已经确定了持久化存储使用的角色，见 detectCharacter
+	lastInput      string // 用户最近输入的命令，用来确定登录的 ID
 
 	lstate    *lua.LState
 	onReceive lua.P
 	onSend    lua.P
 
-	timer sync.Map
+	timers    map[string]*Timer
+	listeners map[string][]*lua.LFunction
+	plugins   []*plugin
+	owned     map[*lua.LTable]map[string]bool // 插件在界面上创建的资源，见 own
+	waiters   []*waiter
+	threads   map[*lua.LState]*lua.LTable // spawn 启动的协程及其所属的环境表
+
+	errors []*luaError
+	budget budget
+
+	commands  chan Command
+	sendDepth int // 正在执行的 OnSend 钩子所处理的命令的嵌套层数，恢复协程时为协程开始等待时的层数
+
+	events   chan func()
+	deferred []func()
+	quit     chan struct{}
 }
 
-func NewAPI(config Config) *API {
-	return &API{
-		config: config,
-		screen: printer.NewSimplePrinter(os.Stdout),
+// NewAPI 创建 Lua 接口，并启动执行 Lua 的 goroutine
+func NewAPI(config Config, host string, port int) *API {
+	api := &API{
+		config:   config,
+		host:     host,
+		port:     port,
+		screen:   printer.NewSimplePrinter(os.Stdout),
+		events:   make(chan func(), eventQueueSize),
+		commands: make(chan Command, commandQueueSize),
+		quit:     make(chan struct{}),
+		timers:   make(map[string]*Timer),
+
+		regexps: make(map[string]*regexp.Regexp),
+		threads: make(map[*lua.LState]*lua.LTable),
 	}
+
+	go api.run()
+	if config.MemoryLimit > 0 {
+		go api.watchdog()
+	}
+
+	return api
 }
 
 func (api *API) Init() {
+	for code, err := range api.loadEchoColors() {
+		api.screen.Printf("颜色代码 $%s$ 配置有误: %v\n", code, err)
+	}
+
 	if !api.config.Enable {
 		return
 	}
 
+	file := storeFileName(api.config.Store, api.configDir, api.host, api.port)
+	api.store, api.storeErr = OpenStore(file)
+	if api.storeErr != nil {
+		api.screen.Printf("无法打开持久化存储: %v\n", api.storeErr)
+	} else {
+		api.store.OnError = func(err error) {
+			api.screen.Printf("无法写入持久化存储: %v\n", err)
+		}
+		if api.config.Character != "" {
+			api.store.SetCharacter(api.config.Character)
+			api.characterKnown = true
+		}
+	}
+
 	_ = api.Reload()
+
+	if api.config.Watch {
+		if err := api.watch(); err != nil {
+			api.screen.Printf("无法监视 Lua 脚本: %v\n", err)
+		}
+	}
 }
 
 func (api *API) SetScreen(w printer.Printer) {
 	api.screen = w
 }
 
-func (api *API) SetMud(w io.Writer) {
-	api.mud = w
+func (api *API) SetUI(ui UI) {
+	api.ui = ui
 }
 
+// SetConfigDir 设置配置文件所在的目录，持久化存储文件的相对路径相对于这个目录，需要在 Init 之前调用
+func (api *API) SetConfigDir(dir string) {
+	api.configDir = dir
+}
+
+// Reload 重新加载 Lua 环境，会等待加载完成
 func (api *API) Reload() error {
+	var err error
+	api.call(func() {
+		err = api.reload()
+	})
+
+	return err
+}
+
+func (api *API) reload() error {
+	// 有插件目录时可以没有主程序
 	mainFile := path.Join(api.config.Path, "main.lua")
-	if _, err := os.Open(mainFile); err != nil {
-		api.screen.Printf("Load error: %v\n", err)
-		api.screen.Println("无法打开 lua 主程序，请检查你的配置。")
-		return err
+	hasMain := true
+	if _, err := os.Stat(mainFile); err != nil {
+		if _, e := os.Stat(path.Join(api.config.Path, "plugins")); e != nil {
+			api.screen.Printf("Load error: %v\n", err)
+			api.screen.Println("无法打开 lua 主程序，请检查你的配置。")
+			return err
+		}
+		hasMain = false
 	}
 
+	// 通过 OnSave/OnRestore 在重新加载前后保留脚本的状态
+	var state *lua.LTable
 	if api.lstate != nil {
-		api.lstate.Close()
-		api.screen.Println("Lua 环境已关闭。")
+		state = api.saveState()
 	}
 
+	// 先在新的环境中加载脚本，原来的环境在加载成功之后才关闭，
+	// 这样脚本中有错误时原来的脚本可以继续运行
+	old := api.swapEnv(luaEnv{})
+
 	api.screen.Println("初始化 Lua 环境...")
 
 	luaPath := path.Join(api.config.Path, "?.lua")
@@ -77,30 +202,180 @@ func (api *API) Reload() error {
 
 	api.lstate = lua.NewState()
 
+	if api.config.Sandbox {
+		api.sandbox()
+	}
+	if api.limited() {
+		api.hookCoroutine()
+		// 重新加载本身也在一个事件中执行，同样受资源预算的限制
+		if ctx := api.eventContext(); ctx != nil {
+			api.lstate.SetContext(ctx)
+		}
+	}
+
 	// 为 Lua 环境提供 API
 	api.register()
 
 	l := api.lstate
 
-	l.Panic = func(*lua.LState) {
-		api.Panic(errPanic)
+	// 只有在保护模式之外出错时才会调用 Panic，错误对象位于栈顶
+	l.Panic = func(l *lua.LState) {
+		api.Panic(&lua.ApiError{Type: lua.ApiErrorRun, Object: l.Get(-1)})
 	}
 
-	if err := l.DoFile(mainFile); err != nil {
-		l.Close()
-		api.screen.Printf("Lua 初始化失败：%v\n", err)
-		api.lstate = nil
-		return err
+	if hasMain {
+		if err := l.DoFile(mainFile); err != nil {
+			api.closeEnv(api.swapEnv(old))
+			api.screen.Printf("Lua 初始化失败：%v\n", err)
+			if api.lstate != nil {
+				api.screen.Println("继续使用原来的 Lua 环境。")
+			}
+			return err
+		}
+	}
+
+	if old.lstate != nil {
+		api.closeEnv(old)
+		api.screen.Println("原来的 Lua 环境已关闭。")
 	}
 
+	api.loadPlugins()
+
 	// 和 Lua 环境中的钩子相连接
 	api.hookOn()
 
+	if state != nil {
+		api.restoreState(state)
+	}
+
 	api.screen.Println("Lua 环境初始化完成。")
+	api.emit(api.lstate, "reload")
 
 	return nil
 }
 
+// luaEnv 是一个 Lua 环境以及在其中注册的钩子、监听函数、定时器、协程和插件
+type luaEnv struct {
+	lstate    *lua.LState
+	onReceive lua.P
+	onSend    lua.P
+	timers    map[string]*Timer
+	listeners map[string][]*lua.LFunction
+	plugins   []*plugin
+	owned     map[*lua.LTable]map[string]bool
+	waiters   []*waiter
+	threads   map[*lua.LState]*lua.LTable
+}
+
+// swapEnv 把当前的 Lua 环境换成 env，返回原来的环境，env 中为 nil 的表会被创建
+func (api *API) swapEnv(env luaEnv) luaEnv {
+	old := luaEnv{
+		lstate:    api.lstate,
+		onReceive: api.onReceive,
+		onSend:    api.onSend,
+		timers:    api.timers,
+		listeners: api.listeners,
+		plugins:   api.plugins,
+		owned:     api.owned,
+		waiters:   api.waiters,
+		threads:   api.threads,
+	}
+
+	if env.timers == nil {
+		env.timers = make(map[string]*Timer)
+	}
+	if env.listeners == nil {
+		env.listeners = make(map[string][]*lua.LFunction)
+	}
+	if env.threads == nil {
+		env.threads = make(map[*lua.LState]*lua.LTable)
+	}
+
+	api.lstate = env.lstate
+	api.onReceive = env.onReceive
+	api.onSend = env.onSend
+	api.timers = env.timers
+	api.listeners = env.listeners
+	api.plugins = env.plugins
+	api.owned = env.owned
+	api.waiters = env.waiters
+	api.threads = env.threads
+
+	return old
+}
+
+// closeEnv 停止 env 中的定时器和协程并关闭其中的 Lua 环境，env 不能是当前的环境
+func (api *API) closeEnv(env luaEnv) {
+	cur := api.swapEnv(env)
+	api.clearTimers()
+	api.clearWaiters()
+	if api.lstate != nil {
+		api.lstate.Close()
+	}
+	api.swapEnv(cur)
+}
+
+// saveState 调用 Lua 中的 OnSave()，返回它所返回的状态表的副本，副本中只包含数据，不包含函数等
+func (api *API) saveState() *lua.LTable {
+	l := api.lstate
+	fn := l.GetGlobal("OnSave")
+	if fn.Type() != lua.LTFunction {
+		return nil
+	}
+
+	if err := l.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}); err != nil {
+		api.Panic(err)
+		return nil
+	}
+	ret := l.Get(-1)
+	l.Pop(1)
+
+	state, ok := copyData(l, ret, map[*lua.LTable]*lua.LTable{}).(*lua.LTable)
+	if !ok {
+		api.screen.Println("OnSave 应当返回一个表，状态没有保存。")
+		return nil
+	}
+
+	return state
+}
+
+// restoreState 以 saveState 保存的状态调用新的 Lua 环境中的 OnRestore(state)
+func (api *API) restoreState(state *lua.LTable) {
+	l := api.lstate
+	fn := l.GetGlobal("OnRestore")
+	if fn.Type() != lua.LTFunction {
+		return
+	}
+
+	if err := l.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, state); err != nil {
+		api.Panic(err)
+	}
+}
+
+// copyData 深度复制 v 中的字符串、数字、布尔值和表，其它类型的值被丢弃，
+// 复制出来的表不含元表和函数，关闭 l 之后仍然可以交给新的 Lua 环境使用
+func copyData(l *lua.LState, v lua.LValue, copied map[*lua.LTable]*lua.LTable) lua.LValue {
+	switch v := v.(type) {
+	case lua.LString, lua.LNumber, lua.LBool:
+		return v
+	case *lua.LTable:
+		if t, ok := copied[v]; ok {
+			return t
+		}
+		t := l.NewTable()
+		copied[v] = t
+		v.ForEach(func(key, value lua.LValue) {
+			key, value = copyData(l, key, copied), copyData(l, value, copied)
+			if key != lua.LNil && value != lua.LNil {
+				t.RawSet(key, value)
+			}
+		})
+		return t
+	default:
+		return lua.LNil
+	}
+}
+
 func (api *API) register() {
 	l := api.lstate
 
@@ -113,10 +388,34 @@ func (api *API) register() {
 	l.SetGlobal("AddMSTimer", l.NewFunction(api.LuaAddTimer))
 	l.SetGlobal("DelTimer", l.NewFunction(api.LuaDelTimer))
 	l.SetGlobal("DelMSTimer", l.NewFunction(api.LuaDelTimer))
+	l.SetGlobal("PauseTimer", l.NewFunction(api.LuaPauseTimer))
+	l.SetGlobal("ResumeTimer", l.NewFunction(api.LuaResumeTimer))
+	l.SetGlobal("On", l.NewFunction(api.LuaOn))
+	l.SetGlobal("Off", l.NewFunction(api.LuaOff))
+	l.SetGlobal("Emit", l.NewFunction(api.LuaEmit))
+	l.SetGlobal("spawn", l.NewFunction(api.LuaSpawn))
+	l.SetGlobal("wait", l.NewFunction(api.LuaWait))
+	l.SetGlobal("waitLine", l.NewFunction(api.LuaWaitLine))
+	l.SetGlobal("waitPrompt", l.NewFunction(api.LuaWaitPrompt))
+	l.SetGlobal("SetCompletions", l.NewFunction(api.LuaSetCompletions))
+	l.SetGlobal("BindKey", l.NewFunction(api.LuaBindKey))
+	l.SetGlobal("CaptureTo", l.NewFunction(api.LuaCaptureTo))
+	l.SetGlobal("SetStatus", l.NewFunction(api.LuaSetStatus))
+	l.SetGlobal("SetGauge", l.NewFunction(api.LuaSetGauge))
+	l.SetGlobal("DelStatus", l.NewFunction(api.LuaDelStatus))
+
+	api.registerTask()
+	api.registerUI()
+	api.registerStore()
+	api.registerRe()
+	api.registerJSON()
+	api.registerUTF8()
 }
 
 func (api *API) hookOn() {
 	l := api.lstate
+	api.onReceive = lua.P{}
+	api.onSend = lua.P{}
 
 	if v := l.GetGlobal("OnReceive"); v.Type() == lua.LTFunction {
 		api.onReceive = lua.P{
@@ -124,7 +423,7 @@ func (api *API) hookOn() {
 			NRet:    0,
 			Protect: true,
 		}
-	} else {
+	} else if len(api.listeners["receive"]) == 0 {
 		api.screen.Println("Lua 环境中未定义 OnReceive 函数，将无法接收游戏数据。")
 	}
 
@@ -134,53 +433,84 @@ func (api *API) hookOn() {
 			NRet:    1,
 			Protect: true,
 		}
-	} else {
+	} else if len(api.listeners["send"]) == 0 {
 		api.screen.Println("Lua 环境中未定义 OnSend 函数，将无法获知向游戏发送的数据。")
 	}
 }
 
-func (api *API) OnReceive(raw, input string) {
-	if api.lstate == nil ||
-		api.onReceive.Fn == nil ||
-		api.onReceive.Fn.Type() != lua.LTFunction {
+// OnReceive 把收到的一行交给 Lua 中的 OnReceive(raw, input, prompt) 钩子以及 receive 事件，
+// 不等待其执行，prompt 为 true 表示这一行没有以换行符结束，通常是提示符，此时还会发出 prompt 事件
+func (api *API) OnReceive(raw, input string, prompt bool) {
+	api.post(func() {
+		api.onReceiveHook(raw, input, prompt)
+		if prompt {
+			api.emit(api.lstate, "prompt", lua.LString(raw), lua.LString(input))
+		}
+		api.wakeWaiters(input, prompt)
+	})
+}
+
+func (api *API) onReceiveHook(raw, input string, prompt bool) {
+	if api.lstate == nil {
 		return
 	}
 
 	l := api.lstate
-	err := l.CallByParam(api.onReceive, lua.LString(raw), lua.LString(input))
-	if err != nil {
-		api.Panic(err)
+	args := []lua.LValue{lua.LString(raw), lua.LString(input), lua.LBool(prompt)}
+	if api.onReceive.Fn != nil && api.onReceive.Fn.Type() == lua.LTFunction {
+		if err := l.CallByParam(api.onReceive, args...); err != nil {
+			api.Panic(err)
+		}
 	}
+
+	api.emit(l, "receive", args...)
+}
+
+// OnSend 调用 Lua 中的 OnSend(cmd, secret) 钩子，secret 为 true 表示 cmd 是密码等机密内容，
+// depth 为 cmd 的嵌套层数，用户输入的命令为 0，Run 执行的命令见 Command。
+// 会等待钩子执行完毕，返回值表示是否还需要把 cmd 发送给服务器。
+func (api *API) OnSend(cmd string, secret bool, depth int) bool {
+	send := true
+	api.call(func() {
+		if depth == 0 {
+			api.detectCharacter(cmd, secret)
+		}
+		api.sendDepth = depth
+		send = api.onSendHook(cmd, secret)
+		api.sendDepth = 0
+	})
+
+	return send
 }
 
-func (api *API) OnSend(cmd string) bool {
-	if api.lstate == nil ||
-		api.onSend.Fn == nil ||
-		api.onSend.Fn.Type() != lua.LTFunction {
+// onSendHook 调用 OnSend 钩子以及 send 事件的监听函数，任何一个返回 false 都表示不再发送 cmd
+func (api *API) onSendHook(cmd string, secret bool) bool {
+	if api.lstate == nil {
 		return true
 	}
 
 	l := api.lstate
-	err := l.CallByParam(api.onSend, lua.LString(cmd))
-	if err != nil {
-		api.Panic(err)
-	}
-
-	ret := l.Get(-1)
-	l.Pop(1)
+	args := []lua.LValue{lua.LString(cmd), lua.LBool(secret)}
+	send := true
+	if api.onSend.Fn != nil && api.onSend.Fn.Type() == lua.LTFunction {
+		err := l.CallByParam(api.onSend, args...)
+		if err != nil {
+			api.Panic(err)
+		}
 
-	return ret != lua.LFalse
-}
+		ret := l.Get(-1)
+		l.Pop(1)
+		send = ret != lua.LFalse
+	}
 
-func (api *API) Panic(err error) {
-	api.screen.Printf("Lua error: %v\n", err)
+	return api.emit(l, "send", args...) && send
 }
 
 func (api *API) LuaRegEx(l *lua.LState) int {
 	text := l.ToString(1)
 	regex := l.ToString(2)
 
-	re, err := regexp.Compile(regex)
+	re, err := api.compile(regex)
 	if err != nil {
 		l.Push(lua.LString("0"))
 		return 1
@@ -214,123 +544,133 @@ func (api *API) LuaPrint(l *lua.LState) int {
 	return 0
 }
 
+// LuaEcho 对应 Lua 中的 Echo(text)，把 text 中的颜色代码转换为 ANSI 控制码后显示出来，
+// 并像服务器发来的内容一样交给 OnReceive 处理
 func (api *API) LuaEcho(l *lua.LState) int {
-	text := l.ToString(1)
-
-	codes := map[string]string{
-		"$BLK$": "[black::]",
-		"$NOR$": "[-:-:-]",
-		"$RED$": "[red::]",
-		"$HIR$": "[red::b]",
-		"$GRN$": "[green::]",
-		"$HIG$": "[green::b]",
-		"$YEL$": "[yellow::]",
-		"$HIY$": "[yellow::b]",
-		"$BLU$": "[blue::]",
-		"$HIB$": "[blue::b]",
-		"$MAG$": "[darkmagenta::]",
-		"$HIM$": "[#ff00ff::]",
-		"$CYN$": "[dardcyan::]",
-		"$HIC$": "[#00ffff::]",
-		"$WHT$": "[white::]",
-		"$HIW$": "[#ffffff::]",
-		"$BNK$": "[::l]",
-		"$REV$": "[::7]",
-		"$U$":   "[::u]",
-	}
-
-	re := regexp.MustCompile(`\$(BLK|NOR|RED|HIR|GRN|HIG|YEL|HIY|BLU|HIB|MAG|HIM|CYN|HIC|WHT|HIW|BNK|REV|U)\$`)
-	text = re.ReplaceAllStringFunc(text, func(code string) string {
-		code, ok := codes[code]
-		if ok {
-			return code
-		}
-		api.screen.Printf("Find Unknown Color Code: %s\n", code)
-		return ""
-	})
+	text := api.echoToANSI(l.ToString(1))
 
+	input := ansi.Strip(text)
 	api.screen.Println(text)
-
-	// TODO: 这里暂时不支持 ANSI 到 PLAIN 的转换
-	api.OnReceive(text, text)
+	api.onReceiveHook(text, input, false)
+	// Echo 可能是在协程中调用的，等当前的 Lua 代码执行完之后再唤醒等待这一行的协程
+	api.later(func() {
+		api.wakeWaiters(input, false)
+	})
 
 	return 0
 }
 
+// LuaRun 对应 Lua 中的 Run(cmd)，与用户输入 cmd 的效果相同，会经过前缀转换、/ 命令以及 OnSend 钩子。
+// 命令交给主程序执行，所以 Run 返回时命令还没有执行
 func (api *API) LuaRun(l *lua.LState) int {
 	text := l.ToString(1)
-	api.screen.Println(text)
+	if err := api.queueCommand(text); err != nil {
+		l.RaiseError("%v", err)
+	}
 	return 0
 }
 
+// LuaSend 对应 Lua 中的 Send(cmd)，把 cmd 原样发送给服务器，不经过 OnSend 钩子。
+// 命令与 Run 的命令排在同一个队列中，以保持先后顺序
 func (api *API) LuaSend(l *lua.LState) int {
 	text := l.ToString(1)
-	fmt.Fprintln(api.mud, text)
+	if err := api.queueRaw(text); err != nil {
+		l.RaiseError("%v", err)
+	}
 	return 0
 }
 
-func (api *API) LuaAddTimer(l *lua.LState) int {
-	id := l.ToString(1)
-	code := l.ToString(2)
-	delay := l.ToInt(3)
-	times := l.ToInt(4)
-
-	go func() {
-		count := 0
-		quit := make(chan bool, 1)
-		timer := Timer{
-			id:       id,
-			code:     code,
-			delay:    delay,
-			maxTimes: times,
-			times:    0,
-			quit:     quit,
-		}
-		v, exists := api.timer.LoadOrStore(id, timer)
-		if exists {
-			v.(Timer).quit <- true
-			api.timer.Store(id, timer)
+// LuaSetCompletions 对应 Lua 中的 SetCompletions(source, {word1, word2, ...})，
+// 为 Tab 补全提供名为 source 的候选词列表，不提供列表时删除该来源
+func (api *API) LuaSetCompletions(l *lua.LState) int {
+	source := l.CheckString(1)
+
+	var words []string
+	if t, ok := l.Get(2).(*lua.LTable); ok {
+		t.ForEach(func(_, v lua.LValue) {
+			words = append(words, v.String())
+		})
+	}
+
+	if api.ui != nil {
+		api.ui.SetCompletions(source, words)
+		api.own(l, ownCompletion, source)
+	}
+
+	return 0
+}
+
+// LuaBindKey 对应 Lua 中的 BindKey(key, binding)，
+// binding 可以是内置功能名称或者要执行的命令，省略时解除绑定
+func (api *API) LuaBindKey(l *lua.LState) int {
+	key := l.CheckString(1)
+	binding := l.OptString(2, "")
+
+	if api.ui != nil {
+		if err := api.ui.BindKey(key, binding); err != nil {
+			l.ArgError(1, err.Error())
 		}
+		api.own(l, ownKey, strings.ToLower(key))
+	}
 
-		for {
-			select {
-			case <-quit:
-				return
-			case <-time.After(time.Millisecond * time.Duration(delay)):
-				timer.Emit(api)
-				count++
-				if times > 0 && times >= count {
-					return
-				}
-			}
+	return 0
+}
+
+// LuaCaptureTo 对应 Lua 中的 CaptureTo(name, line)，把 line 输出到名为 name 的附加窗口
+func (api *API) LuaCaptureTo(l *lua.LState) int {
+	name := l.CheckString(1)
+	line := l.CheckString(2)
+
+	if api.ui != nil {
+		if err := api.ui.CaptureTo(name, line); err != nil {
+			l.RaiseError("%v", err)
 		}
-	}()
+	}
 
 	return 0
 }
 
-func (api *API) LuaDelTimer(l *lua.LState) int {
-	id := l.ToString(1)
-	v, ok := api.timer.Load(id)
-	if ok {
-		v.(Timer).quit <- true
+// LuaSetStatus 对应 Lua 中的 SetStatus(name, text, [color], [line])，设置状态栏字段
+func (api *API) LuaSetStatus(l *lua.LState) int {
+	name := l.CheckString(1)
+	text := l.ToString(2)
+	color := l.OptString(3, "")
+	line := l.OptInt(4, 1)
+
+	if api.ui != nil {
+		api.ui.SetStatus(name, text, color, line)
+		api.own(l, ownStatus, name)
 	}
-	api.timer.Delete(id)
+
 	return 0
 }
 
-type Timer struct {
-	id       string
-	code     string
-	delay    int
-	maxTimes int
-	times    int
-	quit     chan<- bool
+// LuaSetGauge 对应 Lua 中的 SetGauge(name, cur, max, [color], [text], [width], [line])，
+// 以进度条的形式设置状态栏字段，适合显示气血、内力等
+func (api *API) LuaSetGauge(l *lua.LState) int {
+	name := l.CheckString(1)
+	cur := l.CheckInt(2)
+	max := l.CheckInt(3)
+	color := l.OptString(4, "green")
+	text := l.OptString(5, "")
+	width := l.OptInt(6, 0)
+	line := l.OptInt(7, 1)
+
+	if api.ui != nil {
+		api.ui.SetGauge(name, cur, max, text, color, width, line)
+		api.own(l, ownStatus, name)
+	}
+
+	return 0
 }
 
-func (t *Timer) Emit(l *API) {
-	err := l.lstate.DoString(`call_timer_actions("` + t.id + `")`)
-	if err != nil {
-		l.screen.Printf("Lua Error: %v\n", err)
+// LuaDelStatus 对应 Lua 中的 DelStatus(name)，删除状态栏字段
+func (api *API) LuaDelStatus(l *lua.LState) int {
+	name := l.CheckString(1)
+
+	if api.ui != nil {
+		api.ui.DelStatus(name)
 	}
+
+	return 0
 }
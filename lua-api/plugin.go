@@ -0,0 +1,415 @@
+package lua
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// 插件是 Lua 插件路径下 plugins 目录中含有 init.lua 的子目录，每个插件运行在自己的环境表中，
+// 环境表中找不到的变量会到全局环境中查找，所以插件可以使用所有的 API，但插件定义的全局变量互不干扰。
+// 插件之间可以通过 Emit 发出的事件来通信。
+
+// PluginInfo 是插件的描述信息，来自插件目录中可选的 plugin.yaml
+type PluginInfo struct {
+	Name        string
+	Version     string
+	Description string
+	Depends     []string
+}
+
+type plugin struct {
+	PluginInfo
+
+	dir     string
+	env     *lua.LTable // 插件的环境表，插件未加载时为 nil
+	enabled bool
+	err     error
+}
+
+// String 返回插件的描述信息，用于 /plugin 列表
+func (p *plugin) String() string {
+	state := "已加载"
+	switch {
+	case !p.enabled:
+		state = "已禁用"
+	case p.err != nil:
+		// 只显示错误信息的第一行，不显示调用栈
+		state = "加载失败: " + strings.SplitN(p.err.Error(), "\n", 2)[0]
+	case p.env == nil:
+		state = "未加载"
+	}
+
+	name := p.Name
+	if p.Version != "" {
+		name += " " + p.Version
+	}
+	if p.Description != "" {
+		name += " - " + p.Description
+	}
+
+	return fmt.Sprintf("%s [%s]", name, state)
+}
+
+// scanPlugins 扫描插件目录，并按照依赖关系排序，被依赖的插件排在前面
+func (api *API) scanPlugins() ([]*plugin, error) {
+	pluginsDir := path.Join(api.config.Path, "plugins")
+	entries, err := ioutil.ReadDir(pluginsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	disabled := map[string]bool{}
+	for _, name := range strings.Split(api.config.DisabledPlugins, ",") {
+		disabled[strings.TrimSpace(name)] = true
+	}
+
+	plugins := map[string]*plugin{}
+	var names []string
+	for _, entry := range entries {
+		dir := path.Join(pluginsDir, entry.Name())
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(path.Join(dir, "init.lua")); err != nil {
+			continue
+		}
+
+		p := &plugin{dir: dir}
+		if data, err := ioutil.ReadFile(path.Join(dir, "plugin.yaml")); err == nil {
+			if err := yaml.Unmarshal(data, &p.PluginInfo); err != nil {
+				p.err = fmt.Errorf("无法解析 plugin.yaml: %v", err)
+			}
+		}
+		if p.Name == "" {
+			p.Name = entry.Name()
+		}
+		if plugins[p.Name] != nil {
+			continue
+		}
+		p.enabled = !disabled[p.Name]
+
+		plugins[p.Name] = p
+		names = append(names, p.Name)
+	}
+
+	sort.Strings(names)
+
+	// 深度优先遍历依赖关系，visiting 用来发现循环依赖
+	var sorted []*plugin
+	visited := map[string]bool{}
+	visiting := map[string]bool{}
+	var visit func(p *plugin)
+	visit = func(p *plugin) {
+		if visited[p.Name] {
+			return
+		}
+		visiting[p.Name] = true
+		for _, dep := range p.Depends {
+			d := plugins[dep]
+			switch {
+			case d == nil:
+				p.err = fmt.Errorf("缺少依赖的插件 %s", dep)
+			case visiting[dep]:
+				p.err = fmt.Errorf("与插件 %s 循环依赖", dep)
+			default:
+				visit(d)
+			}
+		}
+		visiting[p.Name] = false
+		visited[p.Name] = true
+		sorted = append(sorted, p)
+	}
+	for _, name := range names {
+		visit(plugins[name])
+	}
+
+	return sorted, nil
+}
+
+// loadPlugins 扫描并加载所有启用的插件，某个插件加载失败不影响其它插件
+func (api *API) loadPlugins() {
+	plugins, err := api.scanPlugins()
+	if err != nil {
+		api.screen.Printf("无法读取插件目录: %v\n", err)
+	}
+
+	api.plugins = plugins
+	for _, p := range api.plugins {
+		switch {
+		case !p.enabled:
+		case p.err != nil:
+			api.screen.Printf("插件 %s 加载失败：%v\n", p.Name, p.err)
+		default:
+			api.loadPlugin(p)
+		}
+	}
+}
+
+func (api *API) findPlugin(name string) *plugin {
+	for _, p := range api.plugins {
+		if p.Name == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// loadPlugin 在新的环境表中执行插件的 init.lua
+func (api *API) loadPlugin(p *plugin) {
+	l := api.lstate
+	p.err = nil
+
+	for _, dep := range p.Depends {
+		if d := api.findPlugin(dep); d == nil || d.env == nil {
+			p.err = fmt.Errorf("依赖的插件 %s 未加载", dep)
+			api.screen.Printf("插件 %s 加载失败：%v\n", p.Name, p.err)
+			return
+		}
+	}
+
+	fn, err := l.LoadFile(path.Join(p.dir, "init.lua"))
+	if err != nil {
+		p.err = err
+		api.screen.Printf("插件 %s 加载失败：%v\n", p.Name, err)
+		return
+	}
+
+	env := l.NewTable()
+	meta := l.NewTable()
+	meta.RawSetString("__index", l.Get(lua.GlobalsIndex))
+	l.SetMetatable(env, meta)
+
+	info := l.NewTable()
+	info.RawSetString("name", lua.LString(p.Name))
+	info.RawSetString("version", lua.LString(p.Version))
+	info.RawSetString("dir", lua.LString(p.dir))
+	env.RawSetString("PLUGIN", info)
+
+	fn.Env = env
+	p.env = env
+	if err := l.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}); err != nil {
+		p.err = err
+		api.unloadPlugin(p)
+		api.screen.Printf("插件 %s 加载失败：%v\n", p.Name, err)
+		return
+	}
+}
+
+// unloadPlugin 注销插件注册的监听函数、定时器、等待中的协程以及在界面上创建的资源
+func (api *API) unloadPlugin(p *plugin) {
+	if p.env == nil {
+		return
+	}
+
+	api.removeOwned(p.env)
+
+	for event, listeners := range api.listeners {
+		kept := listeners[:0:0]
+		for _, fn := range listeners {
+			if fn.Env != p.env {
+				kept = append(kept, fn)
+			}
+		}
+		api.listeners[event] = kept
+	}
+
+	for id, t := range api.timers {
+		if t.owner == p.env {
+			api.delTimer(id)
+		}
+	}
+
+	waiters := api.waiters[:0:0]
+	for _, w := range api.waiters {
+		if api.threads[w.th] == p.env {
+			if w.timer != nil {
+				w.timer.Stop()
+			}
+			delete(api.threads, w.th)
+			continue
+		}
+		waiters = append(waiters, w)
+	}
+	api.waiters = waiters
+
+	p.env = nil
+}
+
+// 插件在界面上创建的状态栏字段、按键绑定、补全来源以及附加窗口都按名称记录在 owned 中，
+// 卸载插件时一并删除。这些名称是全局的，后创建的一方成为它的主人。
+const (
+	ownStatus     = "status"
+	ownKey        = "key"
+	ownCompletion = "completion"
+	ownWindow     = "window"
+)
+
+// own 记录调用者所在的插件拥有 kind 类的资源 name，不是插件创建的资源只取消其它插件对它的记录
+func (api *API) own(l *lua.LState, kind, name string) {
+	key := kind + ":" + name
+	for _, owned := range api.owned {
+		delete(owned, key)
+	}
+
+	env := callerEnv(l)
+	if env == nil {
+		return
+	}
+	for _, p := range api.plugins {
+		if p.env == env {
+			if api.owned == nil {
+				api.owned = make(map[*lua.LTable]map[string]bool)
+			}
+			if api.owned[env] == nil {
+				api.owned[env] = make(map[string]bool)
+			}
+			api.owned[env][key] = true
+			return
+		}
+	}
+}
+
+// removeOwned 删除插件在界面上创建的资源
+func (api *API) removeOwned(env *lua.LTable) {
+	owned := api.owned[env]
+	delete(api.owned, env)
+	if api.ui == nil {
+		return
+	}
+
+	for key := range owned {
+		i := strings.Index(key, ":")
+		kind, name := key[:i], key[i+1:]
+		switch kind {
+		case ownStatus:
+			api.ui.DelStatus(name)
+		case ownKey:
+			_ = api.ui.BindKey(name, "")
+		case ownCompletion:
+			api.ui.SetCompletions(name, nil)
+		case ownWindow:
+			_ = api.ui.CloseWindow(name)
+		}
+	}
+}
+
+// callerEnv 返回调用当前 Go 函数的 Lua 函数所在的环境表，用来确定定时器等资源属于哪个插件
+func callerEnv(l *lua.LState) *lua.LTable {
+	dbg, ok := l.GetStack(1)
+	if !ok {
+		return nil
+	}
+
+	fn, err := l.GetInfo("f", dbg, lua.LNil)
+	if err != nil {
+		return nil
+	}
+	if f, ok := fn.(*lua.LFunction); ok {
+		return f.Env
+	}
+
+	return nil
+}
+
+// Plugins 返回所有插件的描述信息
+func (api *API) Plugins() []string {
+	var list []string
+	api.call(func() {
+		for _, p := range api.plugins {
+			list = append(list, p.String())
+		}
+	})
+
+	return list
+}
+
+// rescanPlugins 重新扫描插件目录，已有的插件保持原来的加载状态，新增的插件尚未加载，
+// 已经从目录中删除的插件会被卸载
+func (api *API) rescanPlugins() error {
+	plugins, err := api.scanPlugins()
+	if err != nil {
+		return err
+	}
+
+	found := map[*plugin]bool{}
+	for _, p := range plugins {
+		old := api.findPlugin(p.Name)
+		if old == nil {
+			continue
+		}
+
+		found[old] = true
+		p.env = old.env
+		p.enabled = old.enabled
+		if p.err == nil {
+			p.err = old.err
+		}
+	}
+
+	for _, old := range api.plugins {
+		if !found[old] {
+			api.unloadPlugin(old)
+		}
+	}
+
+	api.plugins = plugins
+	return nil
+}
+
+// ReloadPlugin 重新扫描插件目录并加载插件 name，插件被禁用时会同时启用它，返回的错误不包括加载过程中的错误
+func (api *API) ReloadPlugin(name string) error {
+	var err error
+	api.call(func() {
+		if api.lstate == nil {
+			err = fmt.Errorf("Lua 环境尚未初始化")
+			return
+		}
+		if err = api.rescanPlugins(); err != nil {
+			err = fmt.Errorf("无法读取插件目录: %v", err)
+			return
+		}
+
+		p := api.findPlugin(name)
+		switch {
+		case p == nil:
+			err = fmt.Errorf("插件 %s 不存在", name)
+		default:
+			api.unloadPlugin(p)
+			p.enabled = true
+			// 加载失败时 loadPlugin 已经显示了错误信息
+			api.loadPlugin(p)
+			if p.err == nil {
+				api.screen.Printf("插件 %s 已加载。\n", name)
+			}
+		}
+	})
+
+	return err
+}
+
+// DisablePlugin 卸载并禁用插件 name，直到重新加载 Lua 环境或者再次加载该插件
+func (api *API) DisablePlugin(name string) error {
+	var err error
+	api.call(func() {
+		p := api.findPlugin(name)
+		if p == nil {
+			err = fmt.Errorf("插件 %s 不存在", name)
+			return
+		}
+
+		api.unloadPlugin(p)
+		p.enabled = false
+	})
+
+	return err
+}
@@ -0,0 +1,271 @@
+package lua
+
+import (
+	"regexp"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// re 模块提供 Go 语法的正则表达式，可以预先编译为正则对象，也可以直接以字符串给出，
+// 以字符串给出的正则会被缓存起来，不必每次都重新编译。
+// 匹配结果为一个表，0 为整个匹配，1..n 为各个子匹配，命名的子匹配还可以通过名字访问。
+
+const (
+	regexpTypeName  = "regexp"
+	regexpCacheSize = 256
+)
+
+// compile 编译正则表达式 pattern，编译结果会被缓存
+func (api *API) compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := api.regexps[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// 缓存满了就整个丢掉，脚本中用到的正则通常不多，很快就会重新填满
+	if len(api.regexps) >= regexpCacheSize {
+		api.regexps = make(map[string]*regexp.Regexp)
+	}
+	api.regexps[pattern] = re
+
+	return re, nil
+}
+
+// checkRegexp 读取第 n 个参数作为正则表达式，可以是正则对象或者字符串
+func (api *API) checkRegexp(l *lua.LState, n int) *regexp.Regexp {
+	if ud, ok := l.Get(n).(*lua.LUserData); ok {
+		if re, ok := ud.Value.(*regexp.Regexp); ok {
+			return re
+		}
+	}
+
+	re, err := api.compile(l.CheckString(n))
+	if err != nil {
+		l.ArgError(n, err.Error())
+	}
+
+	return re
+}
+
+// optInit 读取第 n 个参数作为从 1 开始的起始位置，与 string.find 相同，负数表示从末尾倒数
+func optInit(l *lua.LState, n int, s string) int {
+	init := l.OptInt(n, 1)
+	switch {
+	case init < 0:
+		init += len(s) + 1
+		if init < 1 {
+			init = 1
+		}
+	case init == 0:
+		init = 1
+	case init > len(s)+1:
+		init = len(s) + 1
+	}
+
+	return init - 1
+}
+
+// matchTable 把 FindStringSubmatchIndex 的结果转换为匹配结果表，未参与匹配的子匹配为 nil
+func matchTable(l *lua.LState, re *regexp.Regexp, s string, loc []int) *lua.LTable {
+	names := re.SubexpNames()
+	t := l.CreateTable(len(names)-1, 0)
+	for i := range names {
+		if loc[2*i] < 0 {
+			continue
+		}
+		v := lua.LString(s[loc[2*i]:loc[2*i+1]])
+		t.RawSetInt(i, v)
+		if names[i] != "" {
+			t.RawSetString(names[i], v)
+		}
+	}
+
+	return t
+}
+
+// offset 把 loc 中的位置加上 n，用于从中间开始匹配的情况
+func offset(loc []int, n int) []int {
+	for i := range loc {
+		if loc[i] >= 0 {
+			loc[i] += n
+		}
+	}
+
+	return loc
+}
+
+func (api *API) reMatch(l *lua.LState, re *regexp.Regexp, base int) int {
+	s := l.CheckString(base)
+	init := optInit(l, base+1, s)
+
+	loc := re.FindStringSubmatchIndex(s[init:])
+	if loc == nil {
+		l.Push(lua.LNil)
+		return 1
+	}
+
+	l.Push(matchTable(l, re, s, offset(loc, init)))
+	return 1
+}
+
+func (api *API) reFind(l *lua.LState, re *regexp.Regexp, base int) int {
+	s := l.CheckString(base)
+	init := optInit(l, base+1, s)
+
+	loc := re.FindStringSubmatchIndex(s[init:])
+	if loc == nil {
+		l.Push(lua.LNil)
+		return 1
+	}
+
+	loc = offset(loc, init)
+	l.Push(lua.LNumber(loc[0] + 1))
+	l.Push(lua.LNumber(loc[1]))
+	l.Push(matchTable(l, re, s, loc))
+	return 3
+}
+
+func (api *API) reGmatch(l *lua.LState, re *regexp.Regexp, base int) int {
+	s := l.CheckString(base)
+
+	locs := re.FindAllStringSubmatchIndex(s, -1)
+	l.Push(l.NewFunction(func(l *lua.LState) int {
+		if len(locs) == 0 {
+			return 0
+		}
+
+		var loc []int
+		loc, locs = locs[0], locs[1:]
+		l.Push(matchTable(l, re, s, loc))
+		return 1
+	}))
+	return 1
+}
+
+// reGsub 替换 s 中匹配的内容，repl 为字符串时可以用 $1、${name} 引用子匹配，
+// 为函数时以匹配结果表调用它，返回 nil 或 false 时保留原来的内容
+func (api *API) reGsub(l *lua.LState, re *regexp.Regexp, base int) int {
+	s := l.CheckString(base)
+	repl := l.Get(base + 1)
+	n := l.OptInt(base+2, -1)
+
+	var fn *lua.LFunction
+	var template string
+	switch v := repl.(type) {
+	case *lua.LFunction:
+		fn = v
+	case lua.LString, lua.LNumber:
+		template = v.String()
+	default:
+		l.ArgError(base+1, "string or function expected")
+	}
+
+	if n < 0 {
+		n = -1
+	}
+
+	var buf strings.Builder
+	count, last := 0, 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, n) {
+		buf.WriteString(s[last:loc[0]])
+		last = loc[1]
+		count++
+
+		if fn == nil {
+			buf.Write(re.ExpandString(nil, template, s, loc))
+			continue
+		}
+
+		l.Push(fn)
+		l.Push(matchTable(l, re, s, loc))
+		l.Call(1, 1)
+		ret := l.Get(-1)
+		l.Pop(1)
+		if lua.LVIsFalse(ret) {
+			buf.WriteString(s[loc[0]:loc[1]])
+		} else {
+			buf.WriteString(lua.LVAsString(ret))
+		}
+	}
+	buf.WriteString(s[last:])
+
+	l.Push(lua.LString(buf.String()))
+	l.Push(lua.LNumber(count))
+	return 2
+}
+
+// LuaReCompile 对应 Lua 中的 re.compile(pattern)，返回正则对象，
+// 正则对象有 match、find、gmatch、gsub 方法，参数与 re 模块中的同名函数相同，只是不需要 pattern
+func (api *API) LuaReCompile(l *lua.LState) int {
+	re := api.checkRegexp(l, 1)
+
+	ud := l.NewUserData()
+	ud.Value = re
+	l.SetMetatable(ud, l.GetTypeMetatable(regexpTypeName))
+
+	l.Push(ud)
+	return 1
+}
+
+// LuaReMatch 对应 Lua 中的 re.match(pattern, s, [init])，返回匹配结果表，没有匹配时返回 nil
+func (api *API) LuaReMatch(l *lua.LState) int {
+	return api.reMatch(l, api.checkRegexp(l, 1), 2)
+}
+
+// LuaReFind 对应 Lua 中的 re.find(pattern, s, [init])，返回匹配的起止位置以及匹配结果表，没有匹配时返回 nil
+func (api *API) LuaReFind(l *lua.LState) int {
+	return api.reFind(l, api.checkRegexp(l, 1), 2)
+}
+
+// LuaReGmatch 对应 Lua 中的 re.gmatch(pattern, s)，返回依次得到每个匹配结果表的迭代函数
+func (api *API) LuaReGmatch(l *lua.LState) int {
+	return api.reGmatch(l, api.checkRegexp(l, 1), 2)
+}
+
+// LuaReGsub 对应 Lua 中的 re.gsub(pattern, s, repl, [n])，替换前 n 个匹配，省略 n 时替换全部，
+// 返回替换后的字符串以及替换的次数
+func (api *API) LuaReGsub(l *lua.LState) int {
+	return api.reGsub(l, api.checkRegexp(l, 1), 2)
+}
+
+func (api *API) registerRe() {
+	l := api.lstate
+
+	// 正则对象的方法，self 为第一个参数
+	method := func(fn func(*lua.LState, *regexp.Regexp, int) int) lua.LGFunction {
+		return func(l *lua.LState) int {
+			ud := l.CheckUserData(1)
+			re, ok := ud.Value.(*regexp.Regexp)
+			if !ok {
+				l.ArgError(1, "regexp expected")
+			}
+			return fn(l, re, 2)
+		}
+	}
+
+	mt := l.NewTypeMetatable(regexpTypeName)
+	l.SetField(mt, "__index", l.SetFuncs(l.NewTable(), map[string]lua.LGFunction{
+		"match":  method(api.reMatch),
+		"find":   method(api.reFind),
+		"gmatch": method(api.reGmatch),
+		"gsub":   method(api.reGsub),
+	}))
+	l.SetField(mt, "__tostring", l.NewFunction(func(l *lua.LState) int {
+		re, _ := l.CheckUserData(1).Value.(*regexp.Regexp)
+		l.Push(lua.LString("regexp: " + re.String()))
+		return 1
+	}))
+
+	l.SetGlobal("re", l.SetFuncs(l.NewTable(), map[string]lua.LGFunction{
+		"compile": api.LuaReCompile,
+		"match":   api.LuaReMatch,
+		"find":    api.LuaReFind,
+		"gmatch":  api.LuaReGmatch,
+		"gsub":    api.LuaReGsub,
+	}))
+}
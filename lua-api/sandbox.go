@@ -0,0 +1,77 @@
+package lua
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// 启用 Lua.Sandbox 后，脚本不能访问文件和操作系统，只能通过 GoMud 提供的 API 与外界打交道，
+// 这样运行来自社区的脚本时比较放心。require 只能加载 Lua 插件路径下的模块，需要保存的数据可以放在 Store 中。
+
+// sandboxRemoved 是沙箱中不能使用的全局变量，load、loadstring 可以执行任意代码，也一并去掉
+var sandboxRemoved = []string{
+	"io", "debug", "channel", "dofile", "loadfile", "load", "loadstring",
+}
+
+// sandboxOS 是沙箱中可以使用的 os 函数
+var sandboxOS = []string{
+	"time", "clock", "date", "difftime",
+}
+
+// sandbox 按照沙箱的要求限制 Lua 环境
+func (api *API) sandbox() {
+	l := api.lstate
+
+	for _, name := range sandboxRemoved {
+		l.SetGlobal(name, lua.LNil)
+	}
+
+	safe := l.NewTable()
+	if lib, ok := l.GetGlobal("os").(*lua.LTable); ok {
+		for _, name := range sandboxOS {
+			safe.RawSetString(name, lib.RawGetString(name))
+		}
+	}
+	l.SetGlobal("os", safe)
+
+	if pkg, ok := l.GetGlobal("package").(*lua.LTable); ok {
+		pkg.RawSetString("path", lua.LString(path.Join(api.config.Path, "?.lua")))
+
+		// require 默认按 package.path 查找文件，脚本修改它就能加载任意位置的文件，
+		// 所以换成只在插件路径下查找的加载器，之后再修改 package.path 也不起作用
+		if loaders, ok := pkg.RawGetString("loaders").(*lua.LTable); ok {
+			loaders.RawSetInt(2, l.NewFunction(api.sandboxLoader))
+		}
+
+		// require 返回的是 package.loaded 中的模块，这里也要换掉，否则 require("io") 等仍然可以拿到原来的模块
+		if loaded, ok := pkg.RawGetString("loaded").(*lua.LTable); ok {
+			for _, name := range sandboxRemoved {
+				loaded.RawSetString(name, lua.LNil)
+			}
+			loaded.RawSetString("os", safe)
+		}
+	}
+}
+
+// sandboxLoader 代替 require 默认的 Lua 文件加载器，只在 Lua 插件路径下查找模块
+func (api *API) sandboxLoader(l *lua.LState) int {
+	name := l.CheckString(1)
+
+	// 模块名中的 . 都换成了路径分隔符，所以 .. 不会跳出插件路径
+	file := filepath.Join(api.config.Path, strings.Replace(name, ".", string(os.PathSeparator), -1)+".lua")
+	if _, err := os.Stat(file); err != nil {
+		l.Push(lua.LString(err.Error()))
+		return 1
+	}
+
+	fn, err := l.LoadFile(file)
+	if err != nil {
+		l.RaiseError(err.Error())
+	}
+	l.Push(fn)
+	return 1
+}
@@ -0,0 +1,317 @@
+package lua
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Store 是 Lua 脚本的持久化存储，保存在本地的 JSON 文件中，每个服务器一个文件，
+// 文件中再按角色分开保存，这样同一个服务器上的不同角色互不干扰。
+// 修改不会立即写入文件，而是在 storeSaveDelay 之后由另外的 goroutine 一次写入这段时间内的所有修改，
+// 以免频繁修改时阻塞执行 Lua 的 goroutine。写入时先写临时文件再改名，程序崩溃时也不会损坏原有的数据。
+type Store struct {
+	file      string
+	character string // 只在执行 Lua 的 goroutine 中访问
+
+	mu     sync.Mutex // 保护 data 和 timer
+	data   map[string]map[string]interface{}
+	timer  *time.Timer
+	saving sync.Mutex // 保证同一时刻只有一个 goroutine 在写文件
+
+	// OnError 在后台写入文件失败时被调用
+	OnError func(err error)
+}
+
+const storeSaveDelay = time.Second
+
+// storeFileName 根据模板生成存储文件名，相对路径相对于 dir
+func storeFileName(name, dir, host string, port int) string {
+	if name == "" {
+		name = "data/{server}-{port}.json"
+	}
+
+	replacer := strings.NewReplacer(
+		"{server}", host,
+		"{port}", strconv.Itoa(port),
+	)
+
+	name = replacer.Replace(name)
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+
+	return name
+}
+
+// OpenStore 打开存储文件，文件不存在时返回空的存储
+func OpenStore(file string) (*Store, error) {
+	s := &Store{
+		file: file,
+		data: make(map[string]map[string]interface{}),
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &s.data); err != nil {
+		return nil, fmt.Errorf("无法解析 %s: %v", file, err)
+	}
+
+	return s, nil
+}
+
+// Character 返回当前角色
+func (s *Store) Character() string {
+	return s.character
+}
+
+// SetCharacter 切换到角色 name 的存储空间，name 为空表示所有角色共用的存储空间
+func (s *Store) SetCharacter(name string) {
+	s.character = name
+}
+
+// Get 返回当前角色的 key 对应的值，不存在时返回 nil
+func (s *Store) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data[s.character][key]
+}
+
+// Set 设置当前角色的 key 对应的值，稍后写入文件，value 为 nil 时删除 key
+func (s *Store) Set(key string, value interface{}) {
+	if value == nil {
+		s.Delete(key)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := s.data[s.character]
+	if values == nil {
+		values = make(map[string]interface{})
+		s.data[s.character] = values
+	}
+	values[key] = value
+
+	s.schedule()
+}
+
+// Delete 删除当前角色的 key，稍后写入文件
+func (s *Store) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := s.data[s.character]
+	if _, ok := values[key]; !ok {
+		return
+	}
+
+	delete(values, key)
+	if len(values) == 0 {
+		delete(s.data, s.character)
+	}
+
+	s.schedule()
+}
+
+// Keys 按字典序返回当前角色的所有 key
+func (s *Store) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.data[s.character]))
+	for key := range s.data[s.character] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// schedule 安排在 storeSaveDelay 之后写入文件，调用者需持有锁
+func (s *Store) schedule() {
+	if s.timer != nil {
+		return
+	}
+
+	s.timer = time.AfterFunc(storeSaveDelay, func() {
+		if err := s.Flush(); err != nil && s.OnError != nil {
+			s.OnError(err)
+		}
+	})
+}
+
+// Flush 立即写入尚未写入文件的修改，程序退出前需要调用
+func (s *Store) Flush() error {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+
+	s.mu.Lock()
+	if s.timer == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	s.timer.Stop()
+	s.timer = nil
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return s.save(data)
+}
+
+// save 把数据写入临时文件，再改名为存储文件
+func (s *Store) save(data []byte) error {
+	dir := filepath.Dir(s.file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(s.file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.file)
+}
+
+// checkStore 检查存储是否可用，不可用时抛出 Lua 错误
+func (api *API) checkStore(l *lua.LState) *Store {
+	if api.store == nil {
+		l.RaiseError("持久化存储不可用: %v", api.storeErr)
+	}
+
+	return api.store
+}
+
+// LuaStoreGet 对应 Lua 中的 Store.get(key, [default])，返回 key 对应的值，不存在时返回 default
+func (api *API) LuaStoreGet(l *lua.LState) int {
+	s := api.checkStore(l)
+	key := l.CheckString(1)
+
+	if v := s.Get(key); v != nil {
+		l.Push(fromGo(l, v))
+	} else {
+		l.Push(l.Get(2))
+	}
+	return 1
+}
+
+// LuaStoreSet 对应 Lua 中的 Store.set(key, value)，value 可以是字符串、数字、布尔值或者由它们组成的表，
+// 为 nil 时删除 key
+func (api *API) LuaStoreSet(l *lua.LState) int {
+	s := api.checkStore(l)
+	key := l.CheckString(1)
+
+	value, err := toGo(l.Get(2))
+	if err != nil {
+		l.ArgError(2, err.Error())
+	}
+	s.Set(key, value)
+
+	return 0
+}
+
+// LuaStoreDelete 对应 Lua 中的 Store.delete(key)
+func (api *API) LuaStoreDelete(l *lua.LState) int {
+	s := api.checkStore(l)
+	key := l.CheckString(1)
+
+	s.Delete(key)
+
+	return 0
+}
+
+// LuaStoreKeys 对应 Lua 中的 Store.keys()，按字典序返回当前角色的所有 key
+func (api *API) LuaStoreKeys(l *lua.LState) int {
+	s := api.checkStore(l)
+
+	t := l.NewTable()
+	for _, key := range s.Keys() {
+		t.Append(lua.LString(key))
+	}
+
+	l.Push(t)
+	return 1
+}
+
+// LuaStoreCharacter 对应 Lua 中的 Store.character([name])，返回当前角色，
+// 给出 name 时切换到该角色的存储空间，此后不再根据登录时的输入自动切换
+func (api *API) LuaStoreCharacter(l *lua.LState) int {
+	s := api.checkStore(l)
+
+	if l.GetTop() > 0 {
+		s.SetCharacter(l.CheckString(1))
+		api.characterKnown = true
+	}
+
+	l.Push(lua.LString(s.Character()))
+	return 1
+}
+
+// detectCharacter 在没有指定角色时，把第一次输入密码之前用户输入的最后一条命令当作登录的 ID，
+// 切换到该角色的存储空间，并发出 character 事件，只能在执行 Lua 的 goroutine 中调用
+func (api *API) detectCharacter(cmd string, secret bool) {
+	if api.store == nil || api.characterKnown {
+		return
+	}
+	if !secret {
+		api.lastInput = cmd
+		return
+	}
+
+	api.characterKnown = true
+	name := strings.TrimSpace(api.lastInput)
+	if name == "" {
+		return
+	}
+
+	api.store.SetCharacter(name)
+	api.emit(api.lstate, "character", lua.LString(name))
+}
+
+func (api *API) registerStore() {
+	l := api.lstate
+
+	store := l.NewTable()
+	l.SetFuncs(store, map[string]lua.LGFunction{
+		"get":       api.LuaStoreGet,
+		"set":       api.LuaStoreSet,
+		"delete":    api.LuaStoreDelete,
+		"keys":      api.LuaStoreKeys,
+		"character": api.LuaStoreCharacter,
+	})
+	l.SetGlobal("Store", store)
+}
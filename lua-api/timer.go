@@ -0,0 +1,228 @@
+package lua
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Timer 是 Lua 中通过 AddTimer 创建的定时器。
+// 定时器的状态只在执行 Lua 的 goroutine 中读写，计时则由各自的 goroutine 负责。
+type Timer struct {
+	id       string
+	fn       *lua.LFunction // 回调函数，为 nil 时执行 code
+	code     string
+	delay    time.Duration
+	maxTimes int // 最多执行的次数，0 表示不限次数
+	times    int // 已经执行的次数
+	paused   bool
+	stop     chan struct{}
+	owner    *lua.LTable // 创建定时器的代码所在的环境表，用来确定定时器属于哪个插件
+}
+
+// String 返回定时器的描述信息，用于 /timers 列表
+func (t *Timer) String() string {
+	times := fmt.Sprintf("%d", t.times)
+	if t.maxTimes > 0 {
+		times = fmt.Sprintf("%d/%d", t.times, t.maxTimes)
+	}
+
+	state := ""
+	if t.paused {
+		state = " (已暂停)"
+	}
+
+	return fmt.Sprintf("%s: 每 %v 执行一次，已执行 %s 次%s", t.id, t.delay, times, state)
+}
+
+// start 启动计时，使用 time.Ticker 按固定的节拍触发，回调的执行时间不会造成误差累积
+func (t *Timer) start(api *API) {
+	stop := make(chan struct{})
+	t.stop = stop
+
+	ticker := time.NewTicker(t.delay)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case api.events <- func() { api.fireTimer(t, stop) }:
+				case <-stop:
+					return
+				case <-api.quit:
+					return
+				}
+			case <-stop:
+				return
+			case <-api.quit:
+				return
+			}
+		}
+	}()
+}
+
+// halt 停止计时
+func (t *Timer) halt() {
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+// fireTimer 执行定时器的回调，stop 用来识别定时器停止之前就已经排队的触发事件
+func (api *API) fireTimer(t *Timer, stop chan struct{}) {
+	if t.stop != stop || api.timers[t.id] != t {
+		return
+	}
+
+	t.times++
+	if t.maxTimes > 0 && t.times >= t.maxTimes {
+		api.delTimer(t.id)
+	}
+
+	if api.lstate == nil {
+		return
+	}
+
+	fn := t.fn
+	if fn == nil && api.config.TimerHandler != "" {
+		// 兼容旧的机器人脚本，由脚本中的全局函数根据 id 执行定时器的动作
+		if handler, ok := api.lstate.GetGlobal(api.config.TimerHandler).(*lua.LFunction); ok {
+			fn = handler
+		}
+	}
+
+	var err error
+	if fn != nil {
+		err = api.lstate.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, lua.LString(t.id))
+	} else {
+		err = api.lstate.DoString(t.code)
+	}
+
+	if err != nil {
+		api.Panic(err)
+	}
+
+	api.emit(api.lstate, "timer", lua.LString(t.id))
+}
+
+// addTimer 创建定时器，同名的定时器会被替换
+func (api *API) addTimer(t *Timer) {
+	api.delTimer(t.id)
+	api.timers[t.id] = t
+	t.start(api)
+}
+
+func (api *API) delTimer(id string) bool {
+	t, ok := api.timers[id]
+	if !ok {
+		return false
+	}
+
+	t.halt()
+	delete(api.timers, id)
+	return true
+}
+
+// clearTimers 删除所有定时器，在重新加载 Lua 环境时调用
+func (api *API) clearTimers() {
+	for id := range api.timers {
+		api.delTimer(id)
+	}
+}
+
+func (api *API) pauseTimer(id string, pause bool) bool {
+	t, ok := api.timers[id]
+	if !ok {
+		return false
+	}
+
+	if pause && !t.paused {
+		t.halt()
+	} else if !pause && t.paused {
+		t.start(api)
+	}
+	t.paused = pause
+
+	return true
+}
+
+// Timers 返回所有定时器的描述信息，按 id 排序
+func (api *API) Timers() []string {
+	var list []string
+	api.call(func() {
+		for _, t := range api.timers {
+			list = append(list, t.String())
+		}
+	})
+
+	sort.Strings(list)
+	return list
+}
+
+// DelTimer 删除定时器，返回 false 表示定时器不存在
+func (api *API) DelTimer(id string) bool {
+	ok := false
+	api.call(func() {
+		ok = api.delTimer(id)
+	})
+
+	return ok
+}
+
+// PauseTimer 暂停（pause 为 true）或者恢复定时器，返回 false 表示定时器不存在
+func (api *API) PauseTimer(id string, pause bool) bool {
+	ok := false
+	api.call(func() {
+		ok = api.pauseTimer(id, pause)
+	})
+
+	return ok
+}
+
+// LuaAddTimer 对应 Lua 中的 AddTimer(id, action, delay, [times])，
+// action 可以是 Lua 函数或者代码，delay 为间隔的毫秒数，times 为执行次数，省略或者为 0 时不限次数
+func (api *API) LuaAddTimer(l *lua.LState) int {
+	t := &Timer{
+		id:       l.CheckString(1),
+		delay:    time.Duration(l.CheckInt(3)) * time.Millisecond,
+		maxTimes: l.OptInt(4, 0),
+	}
+
+	switch action := l.Get(2).(type) {
+	case *lua.LFunction:
+		t.fn = action
+		t.owner = action.Env
+	default:
+		t.code = lua.LVAsString(action)
+		t.owner = callerEnv(l)
+	}
+
+	if t.delay <= 0 {
+		l.ArgError(3, "定时器的间隔必须大于 0")
+	}
+
+	api.addTimer(t)
+	return 0
+}
+
+// LuaDelTimer 对应 Lua 中的 DelTimer(id)，返回定时器是否存在
+func (api *API) LuaDelTimer(l *lua.LState) int {
+	l.Push(lua.LBool(api.delTimer(l.CheckString(1))))
+	return 1
+}
+
+// LuaPauseTimer 对应 Lua 中的 PauseTimer(id)，返回定时器是否存在
+func (api *API) LuaPauseTimer(l *lua.LState) int {
+	l.Push(lua.LBool(api.pauseTimer(l.CheckString(1), true)))
+	return 1
+}
+
+// LuaResumeTimer 对应 Lua 中的 ResumeTimer(id)，返回定时器是否存在
+func (api *API) LuaResumeTimer(l *lua.LState) int {
+	l.Push(lua.LBool(api.pauseTimer(l.CheckString(1), false)))
+	return 1
+}
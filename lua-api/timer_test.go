@@ -0,0 +1,128 @@
+package lua
+
+import (
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// newTestAPI 返回一个已经注册了 API、但没有加载任何脚本的 Lua 环境，用完之后需要调用 Stop
+func newTestAPI(config Config) *API {
+	api := NewAPI(config, "localhost", 8080)
+	api.call(func() {
+		api.lstate = lua.NewState()
+		api.register()
+	})
+	return api
+}
+
+// doString 在执行 Lua 的 goroutine 中执行 code
+func doString(t *testing.T, api *API, code string) {
+	api.call(func() {
+		if err := api.lstate.DoString(code); err != nil {
+			t.Errorf("DoString(%q) error: %v", code, err)
+		}
+	})
+}
+
+// global 返回 Lua 全局变量 name 的值
+func global(api *API, name string) string {
+	var value string
+	api.call(func() {
+		value = api.lstate.GetGlobal(name).String()
+	})
+	return value
+}
+
+func TestTimerString(t *testing.T) {
+	tests := []struct {
+		timer Timer
+		want  string
+	}{
+		{Timer{id: "a", delay: time.Second}, "a: 每 1s 执行一次，已执行 0 次"},
+		{Timer{id: "b", delay: 500 * time.Millisecond, maxTimes: 3, times: 1}, "b: 每 500ms 执行一次，已执行 1/3 次"},
+		{Timer{id: "c", delay: time.Minute, times: 7, paused: true}, "c: 每 1m0s 执行一次，已执行 7 次 (已暂停)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.timer.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestTimerSchedule(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		want   string // 等待 200ms 之后全局变量 n 的值
+		timers int    // 等待之后剩下的定时器个数
+	}{
+		{
+			"按次数执行后删除",
+			`AddTimer("t", function() n = n + 1 end, 10, 3)`,
+			"3", 0,
+		},
+		{
+			"回调的参数为定时器的 id",
+			`AddTimer("t", function(id) n = id end, 10, 1)`,
+			"t", 0,
+		},
+		{
+			"同名的定时器被替换",
+			`AddTimer("t", function() n = n + 1 end, 10, 2) AddTimer("t", function() n = n + 10 end, 10, 1)`,
+			"10", 0,
+		},
+		{
+			"删除定时器",
+			`AddTimer("t", function() n = n + 1 end, 10) assert(DelTimer("t")) assert(not DelTimer("t"))`,
+			"0", 0,
+		},
+		{
+			"暂停的定时器不执行",
+			`AddTimer("t", function() n = n + 1 end, 10) assert(PauseTimer("t")) assert(not PauseTimer("x"))`,
+			"0", 1,
+		},
+		{
+			"恢复暂停的定时器",
+			`AddTimer("t", function() n = n + 1 end, 10, 2) PauseTimer("t") assert(ResumeTimer("t"))`,
+			"2", 0,
+		},
+		{
+			"代码交给定时器处理函数执行",
+			`function call_timer_actions(id) n = "handled " .. id end AddTimer("t", "n = 'code'", 10, 1)`,
+			"handled t", 0,
+		},
+		{
+			"没有处理函数时直接执行代码",
+			`AddTimer("t", "n = n + 5", 10, 1)`,
+			"5", 0,
+		},
+	}
+
+	for _, tt := range tests {
+		api := newTestAPI(Config{TimerHandler: "call_timer_actions"})
+		doString(t, api, "n = 0 "+tt.code)
+		time.Sleep(200 * time.Millisecond)
+
+		if got := global(api, "n"); got != tt.want {
+			t.Errorf("%s: n = %s, want %s", tt.name, got, tt.want)
+		}
+		if got := len(api.Timers()); got != tt.timers {
+			t.Errorf("%s: %d timers left, want %d", tt.name, got, tt.timers)
+		}
+
+		api.Stop()
+	}
+}
+
+func TestTimerDelay(t *testing.T) {
+	api := newTestAPI(Config{})
+	defer api.Stop()
+
+	doString(t, api, `ok, err = pcall(AddTimer, "t", "", 0)`)
+	if got := global(api, "ok"); got != "false" {
+		t.Errorf("AddTimer with zero delay should fail, got ok = %s", got)
+	}
+}
@@ -0,0 +1,196 @@
+package lua
+
+import (
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/mudclient/go-mud/ansi"
+)
+
+// 让 Lua 脚本可以操作命令行、附加窗口、历史记录以及对话框。
+// 对话框是异步的，用户做出选择之后才会在 Lua 环境中调用回调函数。
+
+// checkUI 检查界面是否可用，不可用时抛出 Lua 错误
+func (api *API) checkUI(l *lua.LState) UI {
+	if api.ui == nil {
+		l.RaiseError("界面尚未初始化")
+	}
+
+	return api.ui
+}
+
+// callback 返回一个在 Lua 环境中以 args 调用 fn 的函数，可以在任意 goroutine 中调用，
+// Lua 环境重新加载之后回调会被忽略
+func (api *API) callback(fn *lua.LFunction) func(args ...lua.LValue) {
+	l := api.lstate
+	return func(args ...lua.LValue) {
+		api.post(func() {
+			if api.lstate != l {
+				return
+			}
+			if err := l.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, args...); err != nil {
+				api.Panic(err)
+			}
+		})
+	}
+}
+
+// LuaGetInput 对应 Lua 中的 GetInput()，返回命令行中的内容
+func (api *API) LuaGetInput(l *lua.LState) int {
+	l.Push(lua.LString(api.checkUI(l).GetInput()))
+	return 1
+}
+
+// LuaSetInput 对应 Lua 中的 SetInput(text)，把命令行的内容设置为 text，例如预先填好回复的命令
+func (api *API) LuaSetInput(l *lua.LState) int {
+	api.checkUI(l).SetInput(l.CheckString(1))
+	return 0
+}
+
+// LuaInsertInput 对应 Lua 中的 InsertInput(text)，在命令行的光标处插入 text
+func (api *API) LuaInsertInput(l *lua.LState) int {
+	api.checkUI(l).InsertInput(l.CheckString(1))
+	return 0
+}
+
+// LuaGetLines 对应 Lua 中的 GetLines(n, [plain])，返回主窗口中最后 n 行的内容，
+// plain 为 true 时去掉颜色等控制码
+func (api *API) LuaGetLines(l *lua.LState) int {
+	lines := api.checkUI(l).Lines(l.CheckInt(1))
+	plain := l.OptBool(2, false)
+
+	t := l.CreateTable(len(lines), 0)
+	for _, line := range lines {
+		if plain {
+			line = ansi.Strip(line)
+		}
+		t.Append(lua.LString(line))
+	}
+
+	l.Push(t)
+	return 1
+}
+
+// LuaOpenWindow 对应 Lua 中的 OpenWindow(name, [position], [size])，创建附加窗口，
+// position 可以是 top/bottom/left/right，之后可以通过 CaptureTo(name, line) 输出到窗口中
+func (api *API) LuaOpenWindow(l *lua.LState) int {
+	name := l.CheckString(1)
+	position := l.OptString(2, "top")
+	size := l.OptInt(3, 0)
+
+	if err := api.checkUI(l).OpenWindow(name, position, size); err != nil {
+		l.RaiseError("%v", err)
+	}
+	api.own(l, ownWindow, name)
+	return 0
+}
+
+// LuaCloseWindow 对应 Lua 中的 CloseWindow(name)，关闭并删除附加窗口
+func (api *API) LuaCloseWindow(l *lua.LState) int {
+	if err := api.checkUI(l).CloseWindow(l.CheckString(1)); err != nil {
+		l.RaiseError("%v", err)
+	}
+	return 0
+}
+
+// LuaShowWindow 对应 Lua 中的 ShowWindow(name, [show])，显示或隐藏附加窗口
+func (api *API) LuaShowWindow(l *lua.LState) int {
+	name := l.CheckString(1)
+	show := l.OptBool(2, true)
+
+	if err := api.checkUI(l).ShowWindow(name, show); err != nil {
+		l.RaiseError("%v", err)
+	}
+	return 0
+}
+
+// LuaClearWindow 对应 Lua 中的 ClearWindow(name)，清空附加窗口的内容
+func (api *API) LuaClearWindow(l *lua.LState) int {
+	if err := api.checkUI(l).ClearWindow(l.CheckString(1)); err != nil {
+		l.RaiseError("%v", err)
+	}
+	return 0
+}
+
+// LuaUIAction 对应 Lua 中的 UIAction(name)，执行翻屏、搜索等内置功能，名称与按键绑定中的相同
+func (api *API) LuaUIAction(l *lua.LState) int {
+	if err := api.checkUI(l).RunAction(l.CheckString(1)); err != nil {
+		l.ArgError(1, err.Error())
+	}
+	return 0
+}
+
+// LuaSearch 对应 Lua 中的 Search(regex, [backward])，进入历史查看模式并搜索 regex
+func (api *API) LuaSearch(l *lua.LState) int {
+	pattern := l.CheckString(1)
+	backward := l.OptBool(2, false)
+
+	if err := api.checkUI(l).Search(pattern, backward); err != nil {
+		l.ArgError(1, err.Error())
+	}
+	return 0
+}
+
+// LuaMenu 对应 Lua 中的 Menu(title, items, fn)，显示一个菜单，
+// 用户选择之后以所选的序号（从 1 开始）和内容调用 fn，取消时以 nil 调用 fn
+func (api *API) LuaMenu(l *lua.LState) int {
+	title := l.CheckString(1)
+	table := l.CheckTable(2)
+	fn := l.CheckFunction(3)
+
+	var items []string
+	for i := 1; i <= table.Len(); i++ {
+		items = append(items, lua.LVAsString(table.RawGetInt(i)))
+	}
+	if len(items) == 0 {
+		l.ArgError(2, "菜单项不能为空")
+	}
+
+	done := api.callback(fn)
+	api.checkUI(l).ShowMenu(title, items, func(index int) {
+		if index < 0 {
+			done(lua.LNil)
+		} else {
+			done(lua.LNumber(index+1), lua.LString(items[index]))
+		}
+	})
+	return 0
+}
+
+// LuaPrompt 对应 Lua 中的 Prompt(title, [text], fn)，显示一个输入框，text 为默认内容，
+// 用户输入完毕后以输入的内容调用 fn，取消时以 nil 调用 fn
+func (api *API) LuaPrompt(l *lua.LState) int {
+	title := l.CheckString(1)
+	text := ""
+	fn, ok := l.Get(2).(*lua.LFunction)
+	if !ok {
+		text = l.CheckString(2)
+		fn = l.CheckFunction(3)
+	}
+
+	done := api.callback(fn)
+	api.checkUI(l).ShowPrompt(title, text, func(text string, ok bool) {
+		if ok {
+			done(lua.LString(text))
+		} else {
+			done(lua.LNil)
+		}
+	})
+	return 0
+}
+
+func (api *API) registerUI() {
+	l := api.lstate
+
+	l.SetGlobal("GetInput", l.NewFunction(api.LuaGetInput))
+	l.SetGlobal("SetInput", l.NewFunction(api.LuaSetInput))
+	l.SetGlobal("InsertInput", l.NewFunction(api.LuaInsertInput))
+	l.SetGlobal("GetLines", l.NewFunction(api.LuaGetLines))
+	l.SetGlobal("OpenWindow", l.NewFunction(api.LuaOpenWindow))
+	l.SetGlobal("CloseWindow", l.NewFunction(api.LuaCloseWindow))
+	l.SetGlobal("ShowWindow", l.NewFunction(api.LuaShowWindow))
+	l.SetGlobal("ClearWindow", l.NewFunction(api.LuaClearWindow))
+	l.SetGlobal("UIAction", l.NewFunction(api.LuaUIAction))
+	l.SetGlobal("Search", l.NewFunction(api.LuaSearch))
+	l.SetGlobal("Menu", l.NewFunction(api.LuaMenu))
+	l.SetGlobal("Prompt", l.NewFunction(api.LuaPrompt))
+}
@@ -0,0 +1,108 @@
+package lua
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/mudclient/go-mud/ansi"
+)
+
+// utf8 模块按字符而不是字节处理字符串，并能计算字符串在终端上的显示宽度，
+// 中日韩文字占两列，ANSI 控制码以及 Echo 的颜色代码不占宽度，方便在 Echo 中画出对齐的表格。
+
+// width 返回 s 的显示宽度
+func (api *API) width(s string) int {
+	return runewidth.StringWidth(ansi.Strip(api.echoToANSI(s)))
+}
+
+// LuaUTF8Len 对应 Lua 中的 utf8.len(s)，返回 s 中的字符数
+func (api *API) LuaUTF8Len(l *lua.LState) int {
+	l.Push(lua.LNumber(utf8.RuneCountInString(l.CheckString(1))))
+	return 1
+}
+
+// LuaUTF8Sub 对应 Lua 中的 utf8.sub(s, i, [j])，与 string.sub 相同，只是以字符为单位
+func (api *API) LuaUTF8Sub(l *lua.LState) int {
+	runes := []rune(l.CheckString(1))
+	n := len(runes)
+	i, j := l.CheckInt(2), l.OptInt(3, -1)
+
+	if i < 0 {
+		i += n + 1
+	}
+	if j < 0 {
+		j += n + 1
+	}
+	if i < 1 {
+		i = 1
+	}
+	if j > n {
+		j = n
+	}
+
+	if i > j {
+		l.Push(lua.LString(""))
+	} else {
+		l.Push(lua.LString(string(runes[i-1 : j])))
+	}
+	return 1
+}
+
+// LuaUTF8Wlen 对应 Lua 中的 utf8.wlen(s)，返回 s 的显示宽度
+func (api *API) LuaUTF8Wlen(l *lua.LState) int {
+	l.Push(lua.LNumber(api.width(l.CheckString(1))))
+	return 1
+}
+
+// LuaUTF8Wpad 对应 Lua 中的 utf8.wpad(s, width, [align])，用空格把 s 补足到 width 列，
+// align 可以是 left（默认）、right 或 center，s 已经足够宽时原样返回
+func (api *API) LuaUTF8Wpad(l *lua.LState) int {
+	s := l.CheckString(1)
+	pad := l.CheckInt(2) - api.width(s)
+	align := l.OptString(3, "left")
+
+	if pad <= 0 {
+		l.Push(lua.LString(s))
+		return 1
+	}
+
+	switch align {
+	case "left":
+		s += strings.Repeat(" ", pad)
+	case "right":
+		s = strings.Repeat(" ", pad) + s
+	case "center":
+		s = strings.Repeat(" ", pad/2) + s + strings.Repeat(" ", pad-pad/2)
+	default:
+		l.ArgError(3, "left, right or center expected")
+	}
+
+	l.Push(lua.LString(s))
+	return 1
+}
+
+// LuaUTF8Wtrunc 对应 Lua 中的 utf8.wtrunc(s, width, [tail])，把 s 截断到不超过 width 列，
+// 截断时在末尾加上 tail（计入宽度）。s 中不能含有颜色代码。
+func (api *API) LuaUTF8Wtrunc(l *lua.LState) int {
+	s := l.CheckString(1)
+	width := l.CheckInt(2)
+	tail := l.OptString(3, "")
+
+	l.Push(lua.LString(runewidth.Truncate(s, width, tail)))
+	return 1
+}
+
+func (api *API) registerUTF8() {
+	l := api.lstate
+
+	l.SetGlobal("utf8", l.SetFuncs(l.NewTable(), map[string]lua.LGFunction{
+		"len":    api.LuaUTF8Len,
+		"sub":    api.LuaUTF8Sub,
+		"wlen":   api.LuaUTF8Wlen,
+		"wpad":   api.LuaUTF8Wpad,
+		"wtrunc": api.LuaUTF8Wtrunc,
+	}))
+}
@@ -0,0 +1,106 @@
+package lua
+
+import (
+	"fmt"
+	"sort"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// toGo 把 Lua 的值转换为可以序列化为 JSON 的 Go 值。
+// 从 1 开始连续编号的表转换为 []interface{}，其它表转换为 map[string]interface{}，数字键会转换为字符串。
+func toGo(v lua.LValue) (interface{}, error) {
+	return toGoValue(v, map[*lua.LTable]bool{})
+}
+
+func toGoValue(v lua.LValue, visiting map[*lua.LTable]bool) (interface{}, error) {
+	switch v := v.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LNumber:
+		return float64(v), nil
+	case lua.LString:
+		return string(v), nil
+	case *lua.LTable:
+		if visiting[v] {
+			return nil, fmt.Errorf("表中存在循环引用")
+		}
+		visiting[v] = true
+		defer delete(visiting, v)
+
+		if isArray(v) {
+			list := make([]interface{}, 0, v.Len())
+			for i := 1; i <= v.Len(); i++ {
+				item, err := toGoValue(v.RawGetInt(i), visiting)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			}
+			return list, nil
+		}
+
+		m := make(map[string]interface{})
+		var err error
+		v.ForEach(func(key, value lua.LValue) {
+			if err != nil {
+				return
+			}
+			switch key.(type) {
+			case lua.LString, lua.LNumber:
+			default:
+				err = fmt.Errorf("不支持 %s 类型的键", key.Type())
+				return
+			}
+			m[key.String()], err = toGoValue(value, visiting)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("不支持 %s 类型的值", v.Type())
+	}
+}
+
+// isArray 判断表是否只有从 1 开始连续编号的元素，空表视为数组
+func isArray(t *lua.LTable) bool {
+	n := 0
+	array := true
+	t.ForEach(func(key, _ lua.LValue) {
+		n++
+		if k, ok := key.(lua.LNumber); !ok || float64(k) != float64(int(k)) || int(k) < 1 {
+			array = false
+		}
+	})
+
+	return array && n == t.Len()
+}
+
+// fromGo 是 toGo 的逆操作，把 Go 值转换为 Lua 的值，对象的键按字典序加入表中
+func fromGo(l *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case []interface{}:
+		t := l.CreateTable(len(v), 0)
+		for i, item := range v {
+			t.RawSetInt(i+1, fromGo(l, item))
+		}
+		return t
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		t := l.CreateTable(0, len(v))
+		for _, key := range keys {
+			t.RawSetString(key, fromGo(l, v[key]))
+		}
+		return t
+	default:
+		return toLValue(v)
+	}
+}
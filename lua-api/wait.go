@@ -0,0 +1,261 @@
+package lua
+
+import (
+	"regexp"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// 机器人脚本可以通过 spawn(fn, ...) 在协程中运行 fn，fn 中可以调用 wait、waitLine、waitPrompt
+// 暂停执行，等到时间到了或者收到了期望的内容时，再由 Go 这边恢复协程，这样脚本就可以按顺序书写。
+
+// spawn 返回的任务对象可以通过 task:cancel() 取消协程，通过 task:status() 查看协程的状态。
+const taskTypeName = "task"
+
+// waiter 是一个正在等待的协程
+type waiter struct {
+	th     *lua.LState
+	re     *regexp.Regexp // 等待匹配该正则的行
+	prompt bool           // 等待提示符
+	timer  *time.Timer
+	depth  int // 开始等待时 Run 命令的嵌套层数，恢复协程时沿用，以免绕过 maxCommandDepth 的限制
+}
+
+// spawn 在新的协程中运行 fn，l 为当前正在运行的 Lua 环境
+func (api *API) spawn(l *lua.LState, fn *lua.LFunction, args ...lua.LValue) *lua.LState {
+	th, _ := l.NewThread()
+	api.threads[th] = fn.Env
+	api.resume(l, th, fn, args...)
+
+	return th
+}
+
+// resume 恢复协程 th 的执行，协程结束、出错或者没有通过 wait 系列函数让出时都会被丢弃
+func (api *API) resume(l, th *lua.LState, fn *lua.LFunction, args ...lua.LValue) {
+	api.bindThread(th)
+	state, err, _ := l.Resume(th, fn, args...)
+	switch state {
+	case lua.ResumeError:
+		delete(api.threads, th)
+		api.Panic(err)
+	case lua.ResumeOK:
+		delete(api.threads, th)
+	case lua.ResumeYield:
+		if api.findWaiter(th) < 0 {
+			delete(api.threads, th)
+			api.screen.Println("Lua error: spawn 启动的协程只能通过 wait、waitLine、waitPrompt 暂停。")
+		}
+	}
+}
+
+func (api *API) findWaiter(th *lua.LState) int {
+	for i, w := range api.waiters {
+		if w.th == th {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// addWaiter 让当前协程开始等待，timeout 大于 0 时超时后以 nil, "timeout" 恢复协程
+func (api *API) addWaiter(w *waiter, timeout time.Duration, values ...lua.LValue) {
+	w.depth = api.sendDepth
+	api.waiters = append(api.waiters, w)
+
+	if timeout > 0 {
+		w.timer = time.AfterFunc(timeout, func() {
+			api.post(func() {
+				api.wake(w, values...)
+			})
+		})
+	}
+}
+
+// wake 以 values 为 wait 系列函数的返回值恢复等待中的协程，协程已经不再等待时什么也不做
+func (api *API) wake(w *waiter, values ...lua.LValue) {
+	i := -1
+	for j, v := range api.waiters {
+		if v == w {
+			i = j
+			break
+		}
+	}
+	if i < 0 || api.lstate == nil {
+		return
+	}
+
+	api.waiters = append(api.waiters[:i], api.waiters[i+1:]...)
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+
+	depth := api.sendDepth
+	api.sendDepth = w.depth
+	api.resume(api.lstate, w.th, nil, values...)
+	api.sendDepth = depth
+}
+
+// wakeWaiters 唤醒等待 input 这一行的协程，prompt 为 true 表示这一行是提示符
+func (api *API) wakeWaiters(input string, prompt bool) {
+	// 被唤醒的协程可能会再次等待，这些新的等待不应该匹配同一行，所以先复制一份
+	waiters := append([]*waiter(nil), api.waiters...)
+	for _, w := range waiters {
+		switch {
+		case w.prompt && prompt:
+			api.wake(w, lua.LString(input))
+		case w.re != nil:
+			subs := w.re.FindStringSubmatch(input)
+			if subs == nil {
+				continue
+			}
+			values := []lua.LValue{lua.LString(input)}
+			for _, sub := range subs[1:] {
+				values = append(values, lua.LString(sub))
+			}
+			api.wake(w, values...)
+		}
+	}
+}
+
+// cancel 取消正在等待的协程 th，协程不会再被恢复，协程已经结束时返回 false
+func (api *API) cancel(th *lua.LState) bool {
+	i := api.findWaiter(th)
+	if i < 0 {
+		return false
+	}
+
+	w := api.waiters[i]
+	api.waiters = append(api.waiters[:i], api.waiters[i+1:]...)
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	delete(api.threads, th)
+
+	return true
+}
+
+// clearWaiters 取消所有正在等待的协程，在重新加载 Lua 环境时调用
+func (api *API) clearWaiters() {
+	for _, w := range api.waiters {
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+	}
+
+	api.waiters = nil
+	api.threads = make(map[*lua.LState]*lua.LTable)
+}
+
+// checkThread 检查 l 是否为 spawn 启动的协程，wait 系列函数只能在这样的协程中调用
+func (api *API) checkThread(l *lua.LState, name string) {
+	if _, ok := api.threads[l]; !ok {
+		l.RaiseError("%s 只能在 spawn 启动的协程中调用", name)
+	}
+}
+
+// optTimeout 读取第 n 个参数作为以秒为单位的超时时间，省略或者为 0 表示不超时
+func optTimeout(l *lua.LState, n int) time.Duration {
+	return time.Duration(float64(l.OptNumber(n, 0)) * float64(time.Second))
+}
+
+// LuaSpawn 对应 Lua 中的 spawn(fn, ...)，在新的协程中以其余参数调用 fn，返回代表该协程的任务对象
+func (api *API) LuaSpawn(l *lua.LState) int {
+	fn := l.CheckFunction(1)
+
+	var args []lua.LValue
+	for i := 2; i <= l.GetTop(); i++ {
+		args = append(args, l.Get(i))
+	}
+
+	ud := l.NewUserData()
+	ud.Value = api.spawn(l, fn, args...)
+	l.SetMetatable(ud, l.GetTypeMetatable(taskTypeName))
+	l.Push(ud)
+	return 1
+}
+
+// checkTask 检查第 n 个参数是否为 spawn 返回的任务对象，返回其中的协程
+func checkTask(l *lua.LState, n int) *lua.LState {
+	th, ok := l.CheckUserData(n).Value.(*lua.LState)
+	if !ok {
+		l.ArgError(n, "task expected")
+	}
+
+	return th
+}
+
+// LuaTaskCancel 对应 Lua 中的 task:cancel()，取消协程并停止它的计时，
+// 协程已经结束时返回 false，协程不能取消自己，需要结束时直接 return 即可
+func (api *API) LuaTaskCancel(l *lua.LState) int {
+	th := checkTask(l, 1)
+	if th == l {
+		l.RaiseError("协程不能取消自己")
+	}
+
+	l.Push(lua.LBool(api.cancel(th)))
+	return 1
+}
+
+// LuaTaskStatus 对应 Lua 中的 task:status()，返回 running（正在运行）、waiting（正在等待）或者 dead（已经结束）
+func (api *API) LuaTaskStatus(l *lua.LState) int {
+	th := checkTask(l, 1)
+
+	status := "dead"
+	if th == l {
+		status = "running"
+	} else if api.findWaiter(th) >= 0 {
+		status = "waiting"
+	}
+
+	l.Push(lua.LString(status))
+	return 1
+}
+
+func (api *API) registerTask() {
+	l := api.lstate
+
+	mt := l.NewTypeMetatable(taskTypeName)
+	l.SetField(mt, "__index", l.SetFuncs(l.NewTable(), map[string]lua.LGFunction{
+		"cancel": api.LuaTaskCancel,
+		"status": api.LuaTaskStatus,
+	}))
+}
+
+// LuaWait 对应 Lua 中的 wait(seconds)，暂停当前协程 seconds 秒
+func (api *API) LuaWait(l *lua.LState) int {
+	api.checkThread(l, "wait")
+
+	delay := optTimeout(l, 1)
+	if delay <= 0 {
+		delay = time.Millisecond
+	}
+	api.addWaiter(&waiter{th: l}, delay)
+
+	return l.Yield()
+}
+
+// LuaWaitLine 对应 Lua 中的 waitLine(regex, [timeout])，暂停当前协程直到收到匹配 regex 的行，
+// 返回该行以及各个子匹配；超过 timeout 秒仍未收到时返回 nil, "timeout"
+func (api *API) LuaWaitLine(l *lua.LState) int {
+	api.checkThread(l, "waitLine")
+
+	re, err := api.compile(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, err.Error())
+	}
+	api.addWaiter(&waiter{th: l, re: re}, optTimeout(l, 2), lua.LNil, lua.LString("timeout"))
+
+	return l.Yield()
+}
+
+// LuaWaitPrompt 对应 Lua 中的 waitPrompt([timeout])，暂停当前协程直到收到提示符，
+// 返回提示符所在的行；超过 timeout 秒仍未收到时返回 nil, "timeout"
+func (api *API) LuaWaitPrompt(l *lua.LState) int {
+	api.checkThread(l, "waitPrompt")
+
+	api.addWaiter(&waiter{th: l, prompt: true}, optTimeout(l, 1), lua.LNil, lua.LString("timeout"))
+
+	return l.Yield()
+}
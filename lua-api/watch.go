@@ -0,0 +1,82 @@
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 启用 Lua.Watch 后，Lua 插件路径下的脚本有变化时会自动重新加载 Lua 环境。
+// 编辑器保存文件时往往会产生好几个事件，所以要等文件安静一段时间之后才重新加载。
+
+const watchDelay = 500 * time.Millisecond
+
+// watch 监视 Lua 插件路径及其所有子目录，直到 Stop 被调用
+func (api *API) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	err = filepath.Walk(api.config.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		return watcher.Add(path)
+	})
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go api.watchLoop(watcher)
+
+	return nil
+}
+
+func (api *API) watchLoop(watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	var timer <-chan time.Time
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// inotify 不会监视子目录，新建的目录需要单独加入
+			if ev.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					_ = watcher.Add(ev.Name)
+				}
+			}
+			if !isScriptFile(ev.Name) || ev.Op == fsnotify.Chmod {
+				continue
+			}
+			timer = time.After(watchDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			api.screen.Printf("监视 Lua 脚本出错: %v\n", err)
+		case <-timer:
+			timer = nil
+			api.screen.Println("Lua 脚本有变化，重新加载...")
+			_ = api.Reload()
+		case <-api.quit:
+			return
+		}
+	}
+}
+
+// isScriptFile 判断文件的变化是否需要重新加载，编辑器的临时文件等会被忽略
+func isScriptFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".lua", ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
-	"regexp"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -12,11 +12,15 @@ import (
 	"github.com/mattn/go-runewidth"
 	"github.com/rivo/tview"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"golang.org/x/text/width"
 
+	"github.com/mudclient/go-mud/ansi"
 	"github.com/mudclient/go-mud/app"
+	"github.com/mudclient/go-mud/logger"
 	"github.com/mudclient/go-mud/lua-api"
 	"github.com/mudclient/go-mud/mud"
+	"github.com/mudclient/go-mud/rules"
 	"github.com/mudclient/go-mud/ui"
 )
 
@@ -24,6 +28,10 @@ type ClientConfig struct {
 	UI  ui.Config
 	Mud mud.Config
 	Lua lua.Config
+	Log logger.Config
+
+	// Rules 为高亮、屏蔽及替换规则，按顺序作用于服务器发来的每一行
+	Rules []rules.Rule
 }
 
 type Client struct {
@@ -31,9 +39,12 @@ type Client struct {
 	ui     *ui.UI
 	lua    *lua.API
 	mud    *mud.Server
+	logger *logger.Logger
+	rules  *rules.Rules
 	quit   chan bool
 
-	debug bool
+	debug  bool
+	secret bool
 }
 
 func main() {
@@ -50,62 +61,122 @@ func NewClient(config ClientConfig) *Client {
 	return &Client{
 		config: config,
 		ui:     ui.NewUI(config.UI),
-		lua:    lua.NewAPI(config.Lua),
+		lua:    lua.NewAPI(config.Lua, config.Mud.Host, config.Mud.Port),
 		mud:    mud.NewServer(config.Mud),
+		logger: logger.NewLogger(config.Log, config.Mud.Host, config.Mud.Port),
+		rules:  rules.NewRules(),
 		quit:   make(chan bool, 1),
 	}
 }
 
 func (c *Client) Run() {
-	ansiRe := regexp.MustCompile("\x1b" + `\[\d*(?:;\d*(?:;\d*)?)?(?:A|D|K|m)`)
-
 	title := fmt.Sprintf("%s(%s), server = %s:%d",
 		app.AppName, app.Version,
 		c.config.Mud.Host, c.config.Mud.Port)
 	c.ui.Create(title)
+	c.ui.SetCompletions("commands", []string{"/version", "/reload-lua", "/debug", "/lines", "/window", "/log", "/timestamp", "/highlight", "/gag", "/rules", "/timers", "/plugin", "/lua"})
 	go c.ui.Run()
+	c.logger.SetScreen(c.ui)
+	if err := c.logger.Init(); err != nil {
+		c.ui.Printf("无法记录日志: %v\n", err)
+	}
+	for _, rule := range c.config.Rules {
+		if err := c.rules.Add(rule); err != nil {
+			c.ui.Printf("规则 %s 有误: %v\n", rule.Pattern, err)
+		}
+	}
 	c.lua.SetScreen(c.ui)
-	c.lua.SetMud(c.mud)
+	c.lua.SetUI(c.ui)
+	c.lua.SetConfigDir(configDir())
 	c.lua.Init()
 	c.mud.SetScreen(c.ui)
 	go c.mud.Run()
 
 	beautify := ambiWidthAdjuster(c.config.UI.AmbiguousWidth)
 
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	c.updateStatus()
+
 LOOP:
 	for {
 		select {
 		case <-c.quit:
 			break LOOP
-		case rawLine, ok := <-c.mud.Input():
+		case text, ok := <-c.mud.Input():
 			if ok {
+				rawLine := text.Line
 				showLine := beautify(rawLine)
-				plainLine := ansiRe.ReplaceAllString(rawLine, "")
+				plainLine := ansi.Strip(rawLine)
 				if c.debug {
 					line := showLine
 					line = strings.ReplaceAll(line, "\x1b[", "<OSI>")
 					line = strings.ReplaceAll(line, "\t", "<TAB>")
 					c.ui.Println(line)
-					line = tview.TranslateANSI(showLine)
+					line = c.ui.Translate(showLine)
 					line = tview.Escape(line)
 					c.ui.Println(line)
 				}
-				c.ui.Println(showLine)
-				c.lua.OnReceive(rawLine, plainLine)
+				showLine, gagged := c.rules.Apply(showLine)
+				if gagged {
+					c.logger.Println("[GAG] " + rawLine)
+				} else {
+					c.ui.Println(showLine)
+					c.ui.CaptureLine(plainLine, showLine)
+					c.logger.Println(rawLine)
+				}
+				c.lua.OnReceive(rawLine, plainLine, text.Prompt)
 			} else {
+				c.lua.Emit("disconnect")
 				defer log.Printf("连接已断开。")
 				break LOOP
 			}
+		case <-c.mud.Connects():
+			c.lua.Emit("connect", c.config.Mud.Host, c.config.Mud.Port)
+		case msg := <-c.mud.GMCP():
+			c.lua.Emit("gmcp", msg.Package, msg.Data)
+		case ev := <-c.ui.Events():
+			c.lua.Emit(ev.Name, ev.Args...)
+		case <-ticker.C:
+			c.updateStatus()
+		case secret := <-c.mud.PasswordMode():
+			c.secret = secret
+			c.ui.SetPasswordMode(secret)
 		case cmd := <-c.ui.Input():
-			c.DoCmd(cmd)
+			c.DoCmd(cmd, 0)
+		case cmd := <-c.lua.Commands():
+			if cmd.Raw {
+				c.mud.Println(cmd.Text)
+			} else {
+				c.DoCmd(cmd.Text, cmd.Depth)
+			}
 		}
 	}
 
+	c.lua.Stop()
+	_ = c.logger.Stop()
 	c.ui.Stop()
 	c.mud.Stop()
 }
 
-func (c *Client) DoCmd(cmd string) {
+// DoCmd 执行一条命令，depth 为命令的嵌套层数，用户输入的命令为 0，Lua 中 Run 执行的命令大于 0
+func (c *Client) DoCmd(cmd string, depth int) {
+	// 用户输入的密码不回显、不做任何转换，仅交给 Lua 过目后直接发送，Lua 执行的命令仍然照常处理
+	if c.secret && depth == 0 {
+		if c.lua.OnSend(cmd, true, depth) {
+			c.mud.Println(cmd)
+		}
+		return
+	}
+
+	// 一行中用分隔符隔开的多条命令依次执行，每条命令都与单独输入时的处理相同
+	if sep := c.config.UI.Separator; sep != "" && strings.Contains(cmd, sep) {
+		for _, sub := range strings.Split(cmd, sep) {
+			c.DoCmd(sub, depth)
+		}
+		return
+	}
+
 	switch cmd {
 	case "exit", "quit":
 		c.quit <- true
@@ -127,6 +198,10 @@ func (c *Client) DoCmd(cmd string) {
 		return
 	}
 
+	if strings.HasPrefix(cmd, "/") && c.slashCmd(cmd) {
+		return
+	}
+
 	if len(cmd) > 0 {
 		switch cmd[0] {
 		case '\'':
@@ -141,12 +216,36 @@ func (c *Client) DoCmd(cmd string) {
 	}
 
 	c.ui.Println(cmd)
-	needSend := c.lua.OnSend(cmd)
+	c.logger.Println(cmd)
+	needSend := c.lua.OnSend(cmd, false, depth)
 	if needSend {
 		c.mud.Println(cmd)
 	}
 }
 
+// configDir 返回配置文件所在的目录，没有使用配置文件时返回当前目录
+func configDir() string {
+	if file := viper.ConfigFileUsed(); file != "" {
+		return filepath.Dir(file)
+	}
+
+	return "."
+}
+
+// updateStatus 更新状态栏中的内置字段
+func (c *Client) updateStatus() {
+	if c.mud.Connected() {
+		c.ui.SetSystemStatus("conn", "已连接", "green")
+	} else {
+		c.ui.SetSystemStatus("conn", "未连接", "red")
+	}
+
+	latency := c.mud.Latency() / time.Millisecond
+	c.ui.SetSystemStatus("latency", fmt.Sprintf("延迟 %dms", latency), "yellow")
+	c.ui.SetSystemStatus("encoding", c.mud.Encoding(), "white")
+	c.ui.SetSystemStatus("clock", time.Now().Format("15:04:05"), "white")
+}
+
 func ambiWidthAdjuster(option string) func(string) string {
 	singleAmbiguousWidth := func(str string) string {
 		return str
@@ -7,7 +7,9 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 	"unicode/utf8"
@@ -17,6 +19,8 @@ import (
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/encoding/traditionalchinese"
 	"golang.org/x/text/transform"
+
+	"github.com/mudclient/go-mud/app"
 )
 
 type Config struct {
@@ -24,6 +28,19 @@ type Config struct {
 	Host      string `flag:"H|mud.pkuxkx.net|服务器 {IP/Domain}"`
 	Port      int    `flag:"P|8080|服务器 {Port}"`
 	Encodings string `flag:"|UTF-8,GB18030,GBK,GB2312|服务器的 {Encodings}，允许指定多个，用逗号分隔"`
+	GMCP      bool   `flag:"|true|服务器支持时是否启用 GMCP 协议"`
+}
+
+// GMCPMessage 是服务器通过 GMCP 协议发来的消息，Data 为 JSON 格式
+type GMCPMessage struct {
+	Package string
+	Data    string
+}
+
+// Text 是从服务器收到的一行文本，Prompt 为 true 表示该行没有以换行符结束，通常是提示符
+type Text struct {
+	Line   string
+	Prompt bool
 }
 
 type Server struct {
@@ -34,31 +51,51 @@ type Server struct {
 	screen printer.Printer
 	server printer.WritePrinter
 
-	conn  net.Conn
-	input chan string
+	conn     net.Conn
+	input    chan Text
+	passwd   chan bool
+	connects chan struct{}
+	gmcp     chan GMCPMessage
+
+	echoOff bool
 
 	encodings []encoding.Encoding
+	encNames  []string
 	decoder   *encoding.Decoder
 	encoder   *encoding.Encoder
+
+	// 以下状态会被其它 goroutine 读取，由 mu 保护
+	mu        sync.Mutex
+	connected bool
+	encName   string
+	sentAt    time.Time
+	latency   time.Duration
 }
 
 func NewServer(config Config) *Server {
 	mud := &Server{
-		config: config,
-		screen: printer.NewSimplePrinter(os.Stdout),
-		server: printer.NewSimplePrinter(ioutil.Discard),
-		input:  make(chan string, 1024),
+		config:   config,
+		screen:   printer.NewSimplePrinter(os.Stdout),
+		server:   printer.NewSimplePrinter(ioutil.Discard),
+		input:    make(chan Text, 1024),
+		passwd:   make(chan bool, 16),
+		connects: make(chan struct{}, 1),
+		gmcp:     make(chan GMCPMessage, 1024),
 	}
 
 	encodings := strings.Split(config.Encodings, ",")
 	for _, enc := range encodings {
 		mud.encodings = append(mud.encodings, resolveEncoding(enc))
+		mud.encNames = append(mud.encNames, strings.ToUpper(strings.TrimSpace(enc)))
 	}
 
 	if len(mud.encodings) == 0 {
 		mud.encodings = []encoding.Encoding{encoding.Nop}
+		mud.encNames = []string{"UTF-8"}
 	}
 
+	mud.encName = mud.encNames[0]
+
 	mud.decoder = mud.encodings[0].NewDecoder()
 	mud.encoder = mud.encodings[0].NewEncoder()
 
@@ -72,7 +109,7 @@ func (mud *Server) SetScreen(w printer.Printer) {
 }
 
 func (mud *Server) Run() {
-	serverAddress := fmt.Sprintf("%s:%d", mud.config.Host, mud.config.Port)
+	serverAddress := net.JoinHostPort(mud.config.Host, strconv.Itoa(mud.config.Port))
 	mud.screen.Printf("连接到服务器 %s...", serverAddress)
 
 	var err error
@@ -86,9 +123,14 @@ func (mud *Server) Run() {
 	}
 
 	mud.screen.Println("连接成功。")
+	mud.setConnected(true)
+	mud.connects <- struct{}{}
 
 	netWriter := transform.NewWriter(mud.conn, mud.encoder)
-	mud.server.SetOutput(netWriter)
+	mud.server.SetOutput(writerFunc(func(p []byte) (int, error) {
+		mud.markSent()
+		return netWriter.Write(p)
+	}))
 
 	scanner := NewScanner(mud.conn)
 
@@ -102,17 +144,26 @@ LOOP:
 		case EOF:
 			break LOOP
 		case IncompleteLine:
+			mud.markReceived()
 			str := mud.tryDecode(m)
-			mud.input <- str
+			mud.input <- Text{Line: str, Prompt: true}
 		case Line:
+			mud.markReceived()
 			str := mud.tryDecode(m)
-			mud.input <- str
+			mud.input <- Text{Line: str}
 		case IACMessage:
 			mud.telnetNegotiate(m)
 		}
 	}
 
 	mud.server.SetOutput(ioutil.Discard)
+	mud.setConnected(false)
+
+	// 登录过程中断开连接时，服务器没有机会再恢复回显，需要自己恢复
+	if mud.echoOff {
+		mud.echoOff = false
+		mud.passwd <- false
+	}
 
 	mud.screen.Println("连接已断开。")
 	mud.screen.Println("TODO: 这里需要实现自动重连。")
@@ -128,12 +179,15 @@ func (mud *Server) tryDecode(r io.Reader) string {
 		return string(buf)
 	}
 
-	for _, enc := range mud.encodings {
+	for i, enc := range mud.encodings {
 		decoder := enc.NewDecoder()
 		buf, _ := decoder.Bytes(rawBuf)
 		if utf8.Valid(buf) && !bytes.ContainsRune(buf, unicode.ReplacementChar) {
 			mud.decoder = decoder
 			mud.encoder = enc.NewEncoder()
+			mud.mu.Lock()
+			mud.encName = mud.encNames[i]
+			mud.mu.Unlock()
 			return string(buf)
 		}
 	}
@@ -159,6 +213,30 @@ func (mud *Server) telnetNegotiate(m IACMessage) {
 	case m.Eq(SB, OptTTYPE, 0x01):
 		mud.conn.Write(append([]byte{IAC, SB, OptTTYPE, 0x00}, []byte("GoMud")...))
 		mud.conn.Write([]byte{IAC, SE})
+	case m.Eq(WILL, OptECHO):
+		// 服务器接管回显，通常意味着接下来要输入密码
+		if !mud.echoOff {
+			mud.echoOff = true
+			mud.conn.Write([]byte{IAC, DO, OptECHO})
+			mud.passwd <- true
+		}
+	case m.Eq(WONT, OptECHO):
+		if mud.echoOff {
+			mud.echoOff = false
+			mud.conn.Write([]byte{IAC, DONT, OptECHO})
+			mud.passwd <- false
+		}
+	case m.Eq(WILL, OptGMCP) && mud.config.GMCP:
+		mud.conn.Write([]byte{IAC, DO, OptGMCP})
+		hello := fmt.Sprintf(`{"client":"GoMud","version":%q}`, app.Version)
+		mud.SendGMCP("Core.Hello", hello)
+	case m.Command == SB && len(m.Args) > 0 && m.Args[0] == OptGMCP:
+		msg := strings.SplitN(string(m.Args[1:]), " ", 2)
+		gmcp := GMCPMessage{Package: msg[0]}
+		if len(msg) > 1 {
+			gmcp.Data = msg[1]
+		}
+		mud.gmcp <- gmcp
 	case m.Eq(WILL):
 		mud.conn.Write([]byte{IAC, DONT, m.Args[0]})
 	case m.Eq(DO):
@@ -171,7 +249,7 @@ func (mud *Server) telnetNegotiate(m IACMessage) {
 	}
 	// TODO: IAC 不继续传递给 UI
 	if mud.config.IACDebug {
-		mud.input <- m.String()
+		mud.input <- Text{Line: m.String()}
 	}
 }
 
@@ -181,10 +259,99 @@ func (mud *Server) Stop() {
 	}
 }
 
-func (mud *Server) Input() <-chan string {
+func (mud *Server) Input() <-chan Text {
 	return mud.input
 }
 
+// Connects 返回一个通道，每次连接成功时收到一个值
+func (mud *Server) Connects() <-chan struct{} {
+	return mud.connects
+}
+
+// GMCP 返回一个通道，用来接收服务器通过 GMCP 协议发来的消息
+func (mud *Server) GMCP() <-chan GMCPMessage {
+	return mud.gmcp
+}
+
+// SendGMCP 通过 GMCP 协议向服务器发送消息，data 为 JSON 格式，可以为空
+func (mud *Server) SendGMCP(pkg, data string) {
+	if mud.conn == nil {
+		return
+	}
+
+	msg := pkg
+	if data != "" {
+		msg += " " + data
+	}
+
+	buf := append([]byte{IAC, SB, OptGMCP}, msg...)
+	buf = append(buf, IAC, SE)
+	mud.conn.Write(buf)
+}
+
+// PasswordMode 返回一个通道，服务器要求关闭本地回显（输入密码）时收到 true，恢复时收到 false。
+func (mud *Server) PasswordMode() <-chan bool {
+	return mud.passwd
+}
+
+func (mud *Server) setConnected(connected bool) {
+	mud.mu.Lock()
+	defer mud.mu.Unlock()
+
+	mud.connected = connected
+}
+
+// markSent 记录命令的发送时间，用来估算网络延迟
+func (mud *Server) markSent() {
+	mud.mu.Lock()
+	defer mud.mu.Unlock()
+
+	if mud.sentAt.IsZero() {
+		mud.sentAt = time.Now()
+	}
+}
+
+// markReceived 在收到服务器数据时根据最近一次的发送时间计算网络延迟
+func (mud *Server) markReceived() {
+	mud.mu.Lock()
+	defer mud.mu.Unlock()
+
+	if !mud.sentAt.IsZero() {
+		mud.latency = time.Since(mud.sentAt)
+		mud.sentAt = time.Time{}
+	}
+}
+
+// Connected 返回当前是否已连接到服务器
+func (mud *Server) Connected() bool {
+	mud.mu.Lock()
+	defer mud.mu.Unlock()
+
+	return mud.connected
+}
+
+// Latency 返回最近一次从发送命令到收到服务器回应所用的时间
+func (mud *Server) Latency() time.Duration {
+	mud.mu.Lock()
+	defer mud.mu.Unlock()
+
+	return mud.latency
+}
+
+// Encoding 返回当前正在使用的服务器编码
+func (mud *Server) Encoding() string {
+	mud.mu.Lock()
+	defer mud.mu.Unlock()
+
+	return mud.encName
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
 func resolveEncoding(e string) encoding.Encoding {
 	e = strings.ToUpper(e)
 	switch e {
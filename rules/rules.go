@@ -0,0 +1,191 @@
+// Package rules 实现了无需 Lua 的高亮、屏蔽及替换规则。
+// 规则按顺序作用于服务器发来的每一行，正则表达式匹配的是去掉了 ANSI 控制码的纯文本。
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mudclient/go-mud/ansi"
+)
+
+const (
+	ActionMatch   = "match"   // 高亮匹配的部分
+	ActionLine    = "line"    // 高亮整行
+	ActionGag     = "gag"     // 不显示该行
+	ActionReplace = "replace" // 把匹配的部分替换为 Replace
+)
+
+// Rule 是一条规则的配置
+type Rule struct {
+	Pattern string
+	Action  string // 可选值: match/line/gag/replace，默认为 match
+	Style   string // 样式，格式为 "前景色:背景色:属性"，例如 "red"、"yellow:blue:b"
+	Replace string // 替换内容，可以用 $1、${name} 引用分组
+}
+
+func (rule Rule) String() string {
+	s := fmt.Sprintf("%-7s %s", rule.Action, rule.Pattern)
+	if rule.Style != "" {
+		s += " 样式: " + rule.Style
+	}
+	if rule.Action == ActionReplace {
+		s += " 替换为: " + rule.Replace
+	}
+	return s
+}
+
+type compiledRule struct {
+	Rule
+	re    *regexp.Regexp
+	style ansi.Style
+}
+
+type Rules struct {
+	mu    sync.Mutex
+	rules []*compiledRule
+}
+
+func NewRules() *Rules {
+	return &Rules{}
+}
+
+// Add 编译并添加一条规则
+func (r *Rules) Add(rule Rule) error {
+	rule.Action = strings.ToLower(rule.Action)
+	if rule.Action == "" {
+		rule.Action = ActionMatch
+	}
+
+	switch rule.Action {
+	case ActionMatch, ActionLine, ActionGag, ActionReplace:
+	default:
+		return fmt.Errorf("未知的规则动作: %s", rule.Action)
+	}
+
+	re, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return err
+	}
+
+	style, err := ansi.ParseStyle(rule.Style)
+	if err != nil {
+		return err
+	}
+
+	if (rule.Action == ActionMatch || rule.Action == ActionLine) && style == (ansi.Style{}) {
+		return fmt.Errorf("高亮规则必须指定样式")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules = append(r.rules, &compiledRule{Rule: rule, re: re, style: style})
+	return nil
+}
+
+// Delete 删除第 i 条规则，i 从 1 开始
+func (r *Rules) Delete(i int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i < 1 || i > len(r.rules) {
+		return fmt.Errorf("规则 %d 不存在", i)
+	}
+
+	r.rules = append(r.rules[:i-1], r.rules[i:]...)
+	return nil
+}
+
+// Clear 删除所有规则
+func (r *Rules) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules = nil
+}
+
+// List 返回所有规则
+func (r *Rules) List() []Rule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]Rule, 0, len(r.rules))
+	for _, rule := range r.rules {
+		list = append(list, rule.Rule)
+	}
+
+	return list
+}
+
+// Apply 把规则依次作用到 line 上，返回处理后的行，gagged 为 true 表示该行不应显示
+func (r *Rules) Apply(line string) (result string, gagged bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rule := range r.rules {
+		plain, index := ansi.Index(line)
+		matches := rule.re.FindAllStringSubmatchIndex(plain, -1)
+		if matches == nil {
+			continue
+		}
+
+		switch rule.Action {
+		case ActionGag:
+			return line, true
+		case ActionLine:
+			line = rule.highlightLine(line)
+		default:
+			line = rule.rewrite(line, plain, index, matches)
+		}
+	}
+
+	return line, false
+}
+
+// highlightLine 把规则的样式叠加到整行上，规则没有指定的颜色和属性保持服务器原来的样子
+func (rule *compiledRule) highlightLine(line string) string {
+	var b strings.Builder
+
+	segments, end := ansi.Parse(line, ansi.Style{})
+	for _, seg := range segments {
+		b.WriteString(seg.Style.With(rule.style).SGR())
+		b.WriteString(seg.Text)
+	}
+	b.WriteString(end.SGR())
+
+	return b.String()
+}
+
+// rewrite 高亮或替换 line 中匹配的部分，并在其后恢复原来的显示属性
+func (rule *compiledRule) rewrite(line, plain string, index []int, matches [][]int) string {
+	var b strings.Builder
+
+	last := 0
+	for _, m := range matches {
+		if m[0] == m[1] {
+			continue
+		}
+
+		begin, end := index[m[0]], index[m[1]-1]+1
+		b.WriteString(line[last:begin])
+
+		if rule.style != (ansi.Style{}) {
+			b.WriteString(rule.style.SGR())
+		}
+
+		if rule.Action == ActionReplace {
+			b.Write(rule.re.ExpandString(nil, rule.Replace, plain, m))
+		} else {
+			b.WriteString(plain[m[0]:m[1]])
+		}
+
+		b.WriteString(ansi.StyleAt(line, end, ansi.Style{}).SGR())
+		last = end
+	}
+	b.WriteString(line[last:])
+
+	return b.String()
+}
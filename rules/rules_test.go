@@ -0,0 +1,134 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		err  bool
+	}{
+		{Rule{Pattern: "hp", Style: "red"}, false},
+		{Rule{Pattern: "hp", Action: "LINE", Style: "red"}, false},
+		{Rule{Pattern: "spam", Action: "gag"}, false},
+		{Rule{Pattern: "foo", Action: "replace", Replace: "bar"}, false},
+		{Rule{Pattern: "hp", Action: "blink", Style: "red"}, true},
+		{Rule{Pattern: "(", Style: "red"}, true},
+		{Rule{Pattern: "hp", Style: "nocolor"}, true},
+		{Rule{Pattern: "hp"}, true},
+		{Rule{Pattern: "hp", Action: "line"}, true},
+	}
+
+	for _, tt := range tests {
+		err := NewRules().Add(tt.rule)
+		if (err != nil) != tt.err {
+			t.Errorf("Add(%+v) error = %v, want error %v", tt.rule, err, tt.err)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []Rule
+		line   string
+		want   string
+		gagged bool
+	}{
+		{"没有规则", nil, "abc", "abc", false},
+		{
+			"高亮匹配的部分",
+			[]Rule{{Pattern: "b", Style: "red"}},
+			"abc", "a\x1b[0;31mb\x1b[0mc", false,
+		},
+		{
+			"高亮之后恢复原来的颜色",
+			[]Rule{{Pattern: "b", Style: "red"}},
+			"\x1b[32mabc", "\x1b[32ma\x1b[0;31mb\x1b[0;32mc", false,
+		},
+		{
+			"跨越控制码匹配纯文本",
+			[]Rule{{Pattern: "ab", Style: "red"}},
+			"a\x1b[1mb", "\x1b[0;31mab\x1b[0;1m", false,
+		},
+		{
+			"多处匹配",
+			[]Rule{{Pattern: "a", Style: "red"}},
+			"aba", "\x1b[0;31ma\x1b[0mb\x1b[0;31ma\x1b[0m", false,
+		},
+		{
+			"忽略空匹配",
+			[]Rule{{Pattern: "x*", Style: "red"}},
+			"ab", "ab", false,
+		},
+		{
+			"整行高亮保留服务器的颜色",
+			[]Rule{{Pattern: "hp", Action: "line", Style: ":blue"}},
+			"\x1b[31mhp\x1b[0m ok", "\x1b[0;31;44mhp\x1b[0;44m ok\x1b[0m", false,
+		},
+		{
+			"屏蔽",
+			[]Rule{{Pattern: "b", Style: "red"}, {Pattern: "^spam", Action: "gag"}},
+			"spam", "spam", true,
+		},
+		{
+			"不匹配时不屏蔽",
+			[]Rule{{Pattern: "^spam", Action: "gag"}},
+			"no spam", "no spam", false,
+		},
+		{
+			"替换并引用分组",
+			[]Rule{{Pattern: `(\w+) says`, Action: "replace", Replace: "$1 说"}},
+			"bob says hi", "bob 说\x1b[0m hi", false,
+		},
+		{
+			"规则依次作用",
+			[]Rule{{Pattern: "foo", Action: "replace", Replace: "bar"}, {Pattern: "bar", Style: "red"}},
+			"foo", "\x1b[0;31mbar\x1b[0m\x1b[0m", false,
+		},
+	}
+
+	for _, tt := range tests {
+		r := NewRules()
+		for _, rule := range tt.rules {
+			if err := r.Add(rule); err != nil {
+				t.Fatalf("%s: Add(%+v) error: %v", tt.name, rule, err)
+			}
+		}
+
+		got, gagged := r.Apply(tt.line)
+		if got != tt.want || gagged != tt.gagged {
+			t.Errorf("%s: Apply(%q) = %q, %v, want %q, %v", tt.name, tt.line, got, gagged, tt.want, tt.gagged)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	r := NewRules()
+	for _, pattern := range []string{"a", "b", "c"} {
+		if err := r.Add(Rule{Pattern: pattern, Action: "gag"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := r.Delete(2); err != nil {
+		t.Fatalf("Delete(2) error: %v", err)
+	}
+	for _, i := range []int{0, 3} {
+		if err := r.Delete(i); err == nil {
+			t.Errorf("Delete(%d) should fail", i)
+		}
+	}
+
+	want := []Rule{{Pattern: "a", Action: "gag"}, {Pattern: "c", Action: "gag"}}
+	if got := r.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %+v, want %+v", got, want)
+	}
+
+	r.Clear()
+	if got := r.List(); len(got) != 0 {
+		t.Errorf("List() after Clear() = %+v", got)
+	}
+}
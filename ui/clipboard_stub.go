@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package ui
+
+import "errors"
+
+// setSystemClipboard 在 Windows 之外的系统上不可用，这些系统上通过 OSC 52 复制
+func setSystemClipboard(text string) error {
+	return errors.New("system clipboard is not supported")
+}
@@ -0,0 +1,71 @@
+//go:build windows
+// +build windows
+
+package ui
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+// Windows 控制台不支持 OSC 52，复制时直接调用 Windows 的剪贴板 API
+
+const (
+	cfUnicodeText = 13
+	gmemMoveable  = 0x0002
+)
+
+var (
+	procOpenClipboard    = u32.NewProc("OpenClipboard")
+	procCloseClipboard   = u32.NewProc("CloseClipboard")
+	procEmptyClipboard   = u32.NewProc("EmptyClipboard")
+	procSetClipboardData = u32.NewProc("SetClipboardData")
+	procGlobalAlloc      = k32.NewProc("GlobalAlloc")
+	procGlobalFree       = k32.NewProc("GlobalFree")
+	procGlobalLock       = k32.NewProc("GlobalLock")
+	procGlobalUnlock     = k32.NewProc("GlobalUnlock")
+	procRtlMoveMemory    = k32.NewProc("RtlMoveMemory")
+)
+
+// setSystemClipboard 把 text 写入 Windows 的剪贴板
+func setSystemClipboard(text string) error {
+	data, err := syscall.UTF16FromString(text)
+	if err != nil {
+		return err
+	}
+
+	if r, _, err := procOpenClipboard.Call(0); r == 0 {
+		return err
+	}
+	defer procCloseClipboard.Call()
+
+	if r, _, err := procEmptyClipboard.Call(); r == 0 {
+		return err
+	}
+
+	size := uintptr(len(data)) * unsafe.Sizeof(data[0])
+	mem, _, err := procGlobalAlloc.Call(gmemMoveable, size)
+	if mem == 0 {
+		return err
+	}
+
+	p, _, err := procGlobalLock.Call(mem)
+	if p == 0 {
+		procGlobalFree.Call(mem)
+		return err
+	}
+	procRtlMoveMemory.Call(p, uintptr(unsafe.Pointer(&data[0])), size)
+	procGlobalUnlock.Call(mem)
+
+	// 设置成功后内存归系统所有，不能再释放
+	if r, _, err := procSetClipboardData.Call(cfUnicodeText, mem); r == 0 {
+		procGlobalFree.Call(mem)
+		if err == nil {
+			err = errors.New("SetClipboardData failed")
+		}
+		return err
+	}
+
+	return nil
+}
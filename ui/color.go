@@ -0,0 +1,183 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/mudclient/go-mud/ansi"
+)
+
+// baseColorNames 是 16 种基本颜色在 tcell 中的名称，按照 ANSI 颜色序号排列
+var baseColorNames = [16]string{
+	"black", "maroon", "green", "olive", "navy", "purple", "teal", "silver",
+	"gray", "red", "lime", "yellow", "blue", "fuchsia", "aqua", "white",
+}
+
+// renderer 把带有 ANSI 控制码的文本转换为 tview 的颜色标签
+type renderer struct {
+	palette ansi.Palette
+	colors  int // 终端可显示的颜色数，0 表示真彩色
+}
+
+// newRenderer 根据配置创建 renderer，配置有误时使用默认值并返回错误
+func newRenderer(config Config) (*renderer, error) {
+	r := &renderer{palette: ansi.DefaultPalette}
+
+	var errs []string
+	switch config.Colors {
+	case "", "truecolor":
+	case "256":
+		r.colors = 256
+	case "16":
+		r.colors = 16
+	default:
+		errs = append(errs, fmt.Sprintf("无效的颜色模式: %s", config.Colors))
+	}
+
+	colors := map[string]string{}
+	if config.Theme != "" {
+		theme, err := loadTheme(config.Theme)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for name, value := range theme {
+			colors[name] = value
+		}
+	}
+	for name, value := range config.Palette {
+		colors[name] = value
+	}
+
+	palette, err := ansi.ParsePalette(colors)
+	if err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		r.palette = palette
+	}
+
+	// 真彩色终端中 tcell 按照 ColorValues 输出基本颜色，这里让它与配色方案保持一致
+	for i, rgb := range r.palette {
+		tcell.ColorValues[tcell.Color(i)] = int32(rgb)
+	}
+
+	if len(errs) > 0 {
+		return r, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return r, nil
+}
+
+// loadTheme 读取 YAML 格式的配色方案文件，文件中为基本颜色名称到 #rrggbb 的映射
+func loadTheme(file string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取配色方案: %v", err)
+	}
+
+	theme := map[string]string{}
+	if err := yaml.Unmarshal(data, &theme); err != nil {
+		return nil, fmt.Errorf("无法解析配色方案 %s: %v", file, err)
+	}
+
+	return theme, nil
+}
+
+// translate 把 text 中的 ANSI 控制码转换为 tview 的颜色标签，并对其余内容转义。
+// style 为开头处的显示属性，返回值中的 Style 为结尾处的显示属性。
+func (r *renderer) translate(text string, style ansi.Style) (string, ansi.Style) {
+	segments, end := ansi.Parse(text, style)
+
+	var b strings.Builder
+	for _, segment := range segments {
+		if segment.Style != style {
+			b.WriteString(r.tag(segment.Style))
+			style = segment.Style
+		}
+		b.WriteString(tview.Escape(segment.Text))
+	}
+	if end != style {
+		b.WriteString(r.tag(end))
+	}
+
+	return b.String(), end
+}
+
+// tag 返回与 style 对应的 tview 颜色标签。
+// 当前的 tcell 没有斜体和删除线属性，斜体以下划线代替，删除线以暗色代替，以免这些文字看起来与普通文字一样。
+func (r *renderer) tag(style ansi.Style) string {
+	attrs := ""
+	flags := []struct {
+		on   bool
+		attr string
+	}{
+		{style.Bold, "b"}, {style.Dim || style.Strike, "d"}, {style.Underline || style.Italic, "u"},
+		{style.Blink, "l"}, {style.Reverse, "r"},
+	}
+	for _, flag := range flags {
+		if flag.on {
+			attrs += flag.attr
+		}
+	}
+	if attrs == "" {
+		attrs = "-"
+	}
+
+	return fmt.Sprintf("[%s:%s:%s]", r.color(style.EffectiveFg()), r.color(style.Bg), attrs)
+}
+
+// color 返回颜色在 tview 颜色标签中的写法，必要时先降低到终端可以显示的颜色数
+func (r *renderer) color(c ansi.Color) string {
+	if r.colors > 0 {
+		c = c.Downsample(&r.palette, r.colors)
+	}
+
+	switch {
+	case c.Type == ansi.ColorDefault:
+		return "-"
+	case c.Type == ansi.ColorIndex && c.Value < 16:
+		// 基本颜色使用颜色名称，以便非真彩色终端使用自己的配色
+		return baseColorNames[c.Value]
+	default:
+		return c.Hex(&r.palette)
+	}
+}
+
+// ansiWriter 把写入的内容转换为 tview 颜色标签后再写入 TextView，
+// 未结束的显示属性会保留到下一次写入。
+type ansiWriter struct {
+	w     io.Writer
+	r     *renderer
+	style ansi.Style
+}
+
+func newANSIWriter(w io.Writer, r *renderer) *ansiWriter {
+	return &ansiWriter{w: w, r: r}
+}
+
+func (a *ansiWriter) Write(p []byte) (int, error) {
+	var text string
+	text, a.style = a.r.translate(string(p), a.style)
+	if _, err := io.WriteString(a.w, text); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// setText 用 text 替换 TextView 的全部内容
+func (a *ansiWriter) setText(tv *tview.TextView, text string) {
+	text, a.style = a.r.translate(text, ansi.Style{})
+	tv.SetText(text)
+}
+
+// Translate 把 text 中的 ANSI 控制码转换为 tview 颜色标签，用于调试显示效果
+func (ui *UI) Translate(text string) string {
+	text, _ = ui.render.translate(text, ansi.Style{})
+	return text
+}
@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/mudclient/go-mud/ansi"
+)
+
+func TestRendererTag(t *testing.T) {
+	red := ansi.Color{Type: ansi.ColorIndex, Value: 1}
+	orange := ansi.Color{Type: ansi.ColorRGB, Value: 0xFF8700}
+
+	tests := []struct {
+		colors int
+		style  ansi.Style
+		want   string
+	}{
+		{0, ansi.Style{}, "[-:-:-]"},
+		{0, ansi.Style{Fg: red}, "[maroon:-:-]"},
+		{0, ansi.Style{Fg: red, Bold: true}, "[red:-:b]"},
+		{0, ansi.Style{Fg: orange, Bg: red}, "[#ff8700:maroon:-]"},
+		{0, ansi.Style{Italic: true}, "[-:-:u]"},
+		{0, ansi.Style{Strike: true}, "[-:-:d]"},
+		{0, ansi.Style{Dim: true, Underline: true, Blink: true, Reverse: true}, "[-:-:dulr]"},
+		{256, ansi.Style{Fg: orange}, "[#ff8700:-:-]"},
+		{16, ansi.Style{Fg: orange}, "[olive:-:-]"},
+		{16, ansi.Style{Fg: ansi.Color{Type: ansi.ColorRGB, Value: 0xF00000}}, "[red:-:-]"},
+	}
+
+	for _, tt := range tests {
+		r := &renderer{palette: ansi.DefaultPalette, colors: tt.colors}
+		if got := r.tag(tt.style); got != tt.want {
+			t.Errorf("tag(%+v) with %d colors = %q, want %q", tt.style, tt.colors, got, tt.want)
+		}
+	}
+}
+
+func TestRendererTranslate(t *testing.T) {
+	tests := []struct {
+		text  string
+		style ansi.Style
+		want  string
+		end   ansi.Style
+	}{
+		{"hello", ansi.Style{}, "hello", ansi.Style{}},
+		{"\x1b[31m红\x1b[0m", ansi.Style{}, "[maroon:-:-]红[-:-:-]", ansi.Style{}},
+		{"续\x1b[0m", ansi.Style{Bold: true}, "续[-:-:-]", ansi.Style{}},
+		{"[tag]", ansi.Style{}, "[tag[]", ansi.Style{}},
+		{"\x1b[4m", ansi.Style{}, "[-:-:u]", ansi.Style{Underline: true}},
+	}
+
+	r := &renderer{palette: ansi.DefaultPalette}
+	for _, tt := range tests {
+		got, end := r.translate(tt.text, tt.style)
+		if got != tt.want || end != tt.end {
+			t.Errorf("translate(%q) = %q, %+v, want %q, %+v", tt.text, got, end, tt.want, tt.end)
+		}
+	}
+}
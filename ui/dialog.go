@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"github.com/gdamore/tcell"
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/tview"
+)
+
+// 对话框显示在整个界面的中央，同一时间只有一个对话框，打开对话框时所有按键都交给它处理，
+// Esc 或者 Ctrl+C 取消对话框。
+
+const dialogPage = "dialog"
+
+// dialog 是当前打开的对话框
+type dialog struct {
+	item   tview.Primitive
+	cancel func()
+}
+
+// hasDialog 判断是否有打开的对话框
+func (ui *UI) hasDialog() bool {
+	ui.Lock()
+	defer ui.Unlock()
+
+	return ui.dialog != nil
+}
+
+// openDialog 打开对话框，已经打开的对话框会被取消，必须在 tview 的事件循环中调用
+func (ui *UI) openDialog(title string, item tview.Primitive, width, height int, cancel func()) {
+	ui.closeDialog(true)
+
+	frame := tview.NewFrame(item).SetBorders(0, 0, 0, 0, 1, 1)
+	frame.SetBorder(true).
+		SetTitle(" " + title + " ").
+		SetBorderColor(tcell.ColorBlue)
+
+	// 上下左右用空白撑开，让对话框显示在中央
+	center := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(frame, height+2, 0, true).
+			AddItem(nil, 0, 1, false), width+4, 0, true).
+		AddItem(nil, 0, 1, false)
+
+	ui.Lock()
+	ui.dialog = &dialog{item: item, cancel: cancel}
+	ui.Unlock()
+
+	ui.root.AddPage(dialogPage, center, true, true)
+	ui.app.SetFocus(item)
+}
+
+// closeDialog 关闭对话框，cancel 为 true 时调用对话框的取消函数，必须在 tview 的事件循环中调用
+func (ui *UI) closeDialog(cancel bool) {
+	ui.Lock()
+	d := ui.dialog
+	ui.dialog = nil
+	ui.Unlock()
+
+	if d == nil {
+		return
+	}
+
+	ui.root.RemovePage(dialogPage)
+	ui.app.SetFocus(ui.cmdLine)
+	if cancel && d.cancel != nil {
+		d.cancel()
+	}
+}
+
+// dialogInputCapture 处理对话框打开时的按键
+func (ui *UI) dialogInputCapture(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		ui.closeDialog(true)
+		return nil
+	}
+
+	// 鼠标点击等可能会让对话框失去焦点，按键总是交给对话框
+	ui.Lock()
+	item := ui.dialog.item
+	ui.Unlock()
+	if ui.app.GetFocus() != item {
+		ui.app.SetFocus(item)
+	}
+
+	return event
+}
+
+// ShowMenu 显示一个菜单，选择第 i 项（从 0 开始）后以 i 调用 done，取消时以 -1 调用 done。
+// done 在界面的事件循环中调用，不能执行耗时的操作。items 为空时不显示菜单，直接以 -1 调用 done。
+func (ui *UI) ShowMenu(title string, items []string, done func(index int)) {
+	if len(items) == 0 {
+		ui.app.QueueUpdate(func() {
+			done(-1)
+		})
+		return
+	}
+
+	ui.app.QueueUpdateDraw(func() {
+		list := tview.NewList().
+			ShowSecondaryText(false).
+			SetHighlightFullLine(true)
+
+		width := runewidth.StringWidth(title)
+		for i, item := range items {
+			index := i
+			shortcut := rune(0)
+			if i < 9 {
+				shortcut = rune('1' + i)
+			}
+			list.AddItem(item, "", shortcut, func() {
+				ui.closeDialog(false)
+				done(index)
+			})
+			if w := runewidth.StringWidth(item) + 4; w > width {
+				width = w
+			}
+		}
+
+		ui.openDialog(title, list, width, len(items), func() { done(-1) })
+	})
+}
+
+// ShowPrompt 显示一个输入框，text 为默认内容，输入完毕后以输入的内容调用 done，取消时 ok 为 false。
+// done 在界面的事件循环中调用，不能执行耗时的操作。
+func (ui *UI) ShowPrompt(title, text string, done func(text string, ok bool)) {
+	ui.app.QueueUpdateDraw(func() {
+		input := tview.NewInputField().
+			SetText(text).
+			SetFieldBackgroundColor(tcell.ColorBlack)
+		input.SetDoneFunc(func(key tcell.Key) {
+			if key == tcell.KeyEnter {
+				ui.closeDialog(false)
+				done(input.GetText(), true)
+			}
+		})
+
+		width := runewidth.StringWidth(title)
+		if width < 40 {
+			width = 40
+		}
+
+		ui.openDialog(title, input, width, 1, func() { done("", false) })
+	})
+}
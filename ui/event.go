@@ -0,0 +1,45 @@
+package ui
+
+import (
+	"github.com/gdamore/tcell"
+)
+
+// Event 是界面产生的事件，例如窗口大小变化（resize）、按键（keypress）等，
+// 由主程序转发给 Lua 脚本
+type Event struct {
+	Name string
+	Args []interface{}
+}
+
+// Events 返回界面事件的通道
+func (ui *UI) Events() <-chan Event {
+	return ui.events
+}
+
+// emit 发出一个事件，通道已满时丢弃该事件，以免阻塞界面
+func (ui *UI) emit(name string, args ...interface{}) {
+	select {
+	case ui.events <- Event{Name: name, Args: args}:
+	default:
+	}
+}
+
+// checkResize 在每次绘制之前检查终端的大小是否发生了变化
+func (ui *UI) checkResize(screen tcell.Screen) bool {
+	width, height := screen.Size()
+	if width != ui.width || height != ui.height {
+		ui.width, ui.height = width, height
+		ui.emit("resize", width, height)
+	}
+
+	return false
+}
+
+// emitKeypress 把功能键以及带有修饰键的按键作为 keypress 事件发出，普通的字符输入不会发出事件
+func (ui *UI) emitKeypress(event *tcell.EventKey) {
+	if event.Key() == tcell.KeyRune && event.Modifiers()&(tcell.ModAlt|tcell.ModCtrl) == 0 {
+		return
+	}
+
+	ui.emit("keypress", eventKeyName(event))
+}
@@ -0,0 +1,138 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+// 按键名称不区分大小写，修饰键与按键之间用 + 或 - 连接，
+// 例如 F1、Shift+F2、Ctrl+L、Alt+x、PgUp、KP8 等，小键盘按键见 keypadKeys。
+var keyAliases = map[string]string{
+	"pageup":   "pgup",
+	"pagedown": "pgdn",
+	"escape":   "esc",
+	"del":      "delete",
+	"ins":      "insert",
+	"return":   "enter",
+	"space":    " ",
+}
+
+// keyActions 是可以绑定到按键上的内置功能，其它绑定内容一律作为命令发送
+var keyActions = map[string]func(ui *UI){
+	"scroll-up":      func(ui *UI) { ui.scroll(func() { ui.pageUp(1) }) },
+	"scroll-down":    func(ui *UI) { ui.scroll(func() { ui.pageDown(1) }) },
+	"page-up":        func(ui *UI) { ui.scroll(func() { ui.pageUp(10) }) },
+	"page-down":      func(ui *UI) { ui.scroll(func() { ui.pageDown(10) }) },
+	"scroll-home":    func(ui *UI) { ui.scroll(ui.pageHome) },
+	"scroll-end":     func(ui *UI) { ui.scroll(ui.pageEnd) },
+	"stop-scrolling": func(ui *UI) { ui.stopScrolling(); ui.app.SetFocus(ui.cmdLine) },
+	"search":         func(ui *UI) { ui.scroll(func() { ui.startSearchPrompt('/') }) },
+	"search-back":    func(ui *UI) { ui.scroll(func() { ui.startSearchPrompt('?') }) },
+	"search-next":    func(ui *UI) { ui.searchNext(false) },
+	"search-prev":    func(ui *UI) { ui.searchNext(true) },
+	"clear-line":     func(ui *UI) { ui.cmdLine.SetText("") },
+	"history-prev":   func(ui *UI) { ui.cmdLine.historyPrev() },
+	"history-next":   func(ui *UI) { ui.cmdLine.historyNext() },
+	"history-search": func(ui *UI) { ui.cmdLine.startSearch(-1) },
+	"focus-window":   func(ui *UI) { ui.focusNextWindow() },
+}
+
+// normalizeKeyName 把用户书写的按键名称转换为统一的形式
+func normalizeKeyName(name string) string {
+	name = strings.ToLower(name)
+	if len(name) == 0 {
+		return name
+	}
+	if len(name) > 1 {
+		name = strings.ReplaceAll(name, "-", "+")
+	}
+
+	i := strings.LastIndex(name[:len(name)-1], "+") + 1
+	if alias, ok := keyAliases[name[i:]]; ok {
+		name = name[:i] + alias
+	}
+
+	return name
+}
+
+// eventKeyName 返回按键事件的统一名称，与 normalizeKeyName 的结果相对应
+func eventKeyName(event *tcell.EventKey) string {
+	name := event.Name()
+	if event.Key() == tcell.KeyRune {
+		name = strings.Replace(name, "Rune["+string(event.Rune())+"]", string(event.Rune()), 1)
+	}
+
+	return normalizeKeyName(name)
+}
+
+// BindKey 把按键绑定到内置功能或命令上，binding 为空时解除绑定
+func (ui *UI) BindKey(key, binding string) error {
+	ui.Lock()
+	defer ui.Unlock()
+
+	key = normalizeKeyName(strings.TrimSpace(key))
+	if key == "" {
+		return errors.New("按键名称不能为空")
+	}
+
+	if binding == "" {
+		delete(ui.keys, key)
+	} else {
+		ui.keys[key] = binding
+	}
+
+	return nil
+}
+
+// handleKeyBinding 执行按键绑定，如果按键没有被绑定则返回 false
+func (ui *UI) handleKeyBinding(event *tcell.EventKey) bool {
+	return ui.runKeyBinding(eventKeyName(event))
+}
+
+// runKeyBinding 执行名为 name 的按键的绑定，如果按键没有被绑定则返回 false。
+// 输入密码时不发送绑定的命令，否则命令会被当作密码发给服务器，此时按键保持原来的作用
+func (ui *UI) runKeyBinding(name string) bool {
+	ui.Lock()
+	binding, ok := ui.keys[name]
+	ui.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	if action, ok := keyActions[binding]; ok {
+		action(ui)
+	} else if ui.cmdLine.IsSecret() {
+		return false
+	} else {
+		ui.input <- binding
+	}
+
+	return true
+}
+
+// RunAction 执行名为 name 的内置功能，与按键绑定的内置功能相同
+func (ui *UI) RunAction(name string) error {
+	action, ok := keyActions[name]
+	if !ok {
+		return fmt.Errorf("没有名为 %s 的功能", name)
+	}
+
+	ui.app.QueueUpdateDraw(func() {
+		action(ui)
+	})
+	return nil
+}
+
+// scroll 在进入历史查看模式后执行 f
+func (ui *UI) scroll(f func()) {
+	if !ui.isScrolling() {
+		ui.app.SetFocus(ui.historyTV)
+		ui.startScrolling()
+	}
+
+	f()
+}
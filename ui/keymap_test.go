@@ -0,0 +1,107 @@
+package ui
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell"
+)
+
+func TestNormalizeKeyName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", ""},
+		{"F1", "f1"},
+		{"Shift-F2", "shift+f2"},
+		{"Ctrl+L", "ctrl+l"},
+		{"PageUp", "pgup"},
+		{"Alt+Escape", "alt+esc"},
+		{"Space", " "},
+		{"KP8", "kp8"},
+		{"-", "-"},
+		{"+", "+"},
+		{"Alt++", "alt++"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeKeyName(tt.name); got != tt.want {
+			t.Errorf("normalizeKeyName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEventKeyName(t *testing.T) {
+	tests := []struct {
+		event *tcell.EventKey
+		name  string // 用户在配置中的写法
+	}{
+		{tcell.NewEventKey(tcell.KeyF1, 0, tcell.ModNone), "F1"},
+		{tcell.NewEventKey(tcell.KeyF2, 0, tcell.ModShift), "Shift-F2"},
+		{tcell.NewEventKey(tcell.KeyCtrlL, 0, tcell.ModCtrl), "Ctrl+L"},
+		{tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModAlt), "Alt+x"},
+		{tcell.NewEventKey(tcell.KeyRune, '+', tcell.ModAlt), "Alt++"},
+		{tcell.NewEventKey(tcell.KeyRune, ' ', tcell.ModNone), "Space"},
+		{tcell.NewEventKey(tcell.KeyPgUp, 0, tcell.ModNone), "PageUp"},
+		{tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), "Return"},
+	}
+
+	for _, tt := range tests {
+		if got, want := eventKeyName(tt.event), normalizeKeyName(tt.name); got != want {
+			t.Errorf("eventKeyName(%s) = %q, want %q", tt.event.Name(), got, want)
+		}
+	}
+}
+
+func TestFindKeypadKey(t *testing.T) {
+	tests := []struct {
+		event *tcell.EventKey
+		name  string // 空串表示不是小键盘按键
+	}{
+		{tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModNone), "kp8"},
+		{tcell.NewEventKey(tcell.KeyRune, 'p', tcell.ModNone), "kp0"},
+		{tcell.NewEventKey(tcell.KeyRune, 'M', tcell.ModNone), "kpenter"},
+		{tcell.NewEventKey(tcell.KeyRune, 'k', tcell.ModNone), "kpplus"},
+		{tcell.NewEventKey(tcell.KeyRune, 'a', tcell.ModNone), ""},
+		{tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModAlt), ""},
+		{tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), ""},
+	}
+
+	prefix := tcell.NewEventKey(tcell.KeyRune, 'O', tcell.ModAlt)
+	if !isKeypadPrefix(prefix) {
+		t.Fatalf("isKeypadPrefix(%s) = false", prefix.Name())
+	}
+
+	for _, tt := range tests {
+		k, ok := findKeypadKey(prefix, tt.event)
+		if ok != (tt.name != "") || k.name != tt.name {
+			t.Errorf("findKeypadKey(%s) = %q, %v, want %q", tt.event.Name(), k.name, ok, tt.name)
+		}
+	}
+
+	// 间隔太久的两次按键是用户分别按下的 Alt+O 和普通按键
+	time.Sleep(keypadTimeout + 10*time.Millisecond)
+	late := tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModNone)
+	if k, ok := findKeypadKey(prefix, late); ok {
+		t.Errorf("findKeypadKey() after timeout = %q", k.name)
+	}
+}
+
+func TestIsKeypadPrefix(t *testing.T) {
+	tests := []struct {
+		event *tcell.EventKey
+		want  bool
+	}{
+		{tcell.NewEventKey(tcell.KeyRune, 'O', tcell.ModAlt), true},
+		{tcell.NewEventKey(tcell.KeyRune, 'O', tcell.ModNone), false},
+		{tcell.NewEventKey(tcell.KeyRune, 'o', tcell.ModAlt), false},
+		{tcell.NewEventKey(tcell.KeyRune, 'O', tcell.ModAlt|tcell.ModCtrl), false},
+	}
+
+	for _, tt := range tests {
+		if got := isKeypadPrefix(tt.event); got != tt.want {
+			t.Errorf("isKeypadPrefix(%s) = %v, want %v", tt.event.Name(), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// tcell 初始化时会让终端进入应用小键盘模式，此时小键盘按键发送 ESC O 加一个字符，
+// 但 tcell 不认识这些序列，会把它们拆成 Alt+O 和一个普通字符。
+// 这里把紧接着到达的这两个事件重新组合成 KP0~KP9、KPEnter 等小键盘按键。
+// 终端没有使用应用小键盘模式时（例如某些终端打开了 NumLock），小键盘按键与数字键、方向键相同，无法区分。
+
+// keypadTimeout 是 Alt+O 之后等待下一个字符的时间，同一个序列中的字符几乎是同时到达的
+const keypadTimeout = 20 * time.Millisecond
+
+// keypadKey 是一个小键盘按键，name 为按键名称，key 和 r 为按键没有绑定时代替它的普通按键
+type keypadKey struct {
+	name string
+	key  tcell.Key
+	r    rune
+}
+
+// keypadKeys 以 ESC O 之后的字符为键
+var keypadKeys = map[rune]keypadKey{
+	'p': {"kp0", tcell.KeyRune, '0'},
+	'q': {"kp1", tcell.KeyRune, '1'},
+	'r': {"kp2", tcell.KeyRune, '2'},
+	's': {"kp3", tcell.KeyRune, '3'},
+	't': {"kp4", tcell.KeyRune, '4'},
+	'u': {"kp5", tcell.KeyRune, '5'},
+	'v': {"kp6", tcell.KeyRune, '6'},
+	'w': {"kp7", tcell.KeyRune, '7'},
+	'x': {"kp8", tcell.KeyRune, '8'},
+	'y': {"kp9", tcell.KeyRune, '9'},
+	'M': {"kpenter", tcell.KeyEnter, '\r'},
+	'j': {"kpmultiply", tcell.KeyRune, '*'},
+	'k': {"kpplus", tcell.KeyRune, '+'},
+	'm': {"kpminus", tcell.KeyRune, '-'},
+	'n': {"kpperiod", tcell.KeyRune, '.'},
+	'o': {"kpdivide", tcell.KeyRune, '/'},
+	'X': {"kpequal", tcell.KeyRune, '='},
+}
+
+// isKeypadPrefix 判断 event 是否可能是小键盘序列的开头，也就是被 tcell 拆出来的 Alt+O
+func isKeypadPrefix(event *tcell.EventKey) bool {
+	return event.Key() == tcell.KeyRune && event.Rune() == 'O' && event.Modifiers() == tcell.ModAlt
+}
+
+// findKeypadKey 判断紧接在 prefix 之后的 event 是否构成小键盘按键
+func findKeypadKey(prefix, event *tcell.EventKey) (keypadKey, bool) {
+	if event.Key() != tcell.KeyRune || event.Modifiers() != tcell.ModNone {
+		return keypadKey{}, false
+	}
+	if event.When().Sub(prefix.When()) > keypadTimeout {
+		return keypadKey{}, false
+	}
+
+	k, ok := keypadKeys[event.Rune()]
+	return k, ok
+}
+
+// keypadInputCapture 识别小键盘按键，只能在界面的事件循环中调用。
+// 返回 nil 表示事件已经处理完毕，否则返回需要继续处理的事件
+func (ui *UI) keypadInputCapture(event *tcell.EventKey) *tcell.EventKey {
+	prefix := ui.keypadPrefix
+	ui.keypadPrefix = nil
+
+	if prefix != nil {
+		if k, ok := findKeypadKey(prefix, event); ok {
+			ui.emit("keypress", k.name)
+			if !ui.isSearchPrompting() && !ui.hasDialog() && ui.runKeyBinding(k.name) {
+				return nil
+			}
+			return tcell.NewEventKey(k.key, k.r, tcell.ModNone)
+		}
+
+		// 不是小键盘按键，先补上被扣下的 Alt+O
+		ui.dispatchKey(prefix)
+	}
+
+	if isKeypadPrefix(event) {
+		ui.keypadPrefix = event
+		time.AfterFunc(keypadTimeout, func() {
+			ui.app.QueueUpdateDraw(func() {
+				if ui.keypadPrefix == event {
+					ui.keypadPrefix = nil
+					ui.dispatchKey(event)
+				}
+			})
+		})
+		return nil
+	}
+
+	return event
+}
+
+// dispatchKey 像 tview 的事件循环一样处理按键事件，用于补上之前被扣下的事件
+func (ui *UI) dispatchKey(event *tcell.EventKey) {
+	if event = ui.inputCapture(event); event == nil {
+		return
+	}
+
+	if p := ui.app.GetFocus(); p != nil {
+		if handler := p.InputHandler(); handler != nil {
+			handler(event, func(p tview.Primitive) {
+				ui.app.SetFocus(p)
+			})
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package ui
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+const wheelLines = 3
+
+// mouseScreen 包装了 tcell.Screen，在事件到达 tview 之前截获鼠标事件。
+// 当前版本的 tview 不处理鼠标事件，因此由 UI 自行处理。
+type mouseScreen struct {
+	tcell.Screen
+	ui *UI
+}
+
+func (s *mouseScreen) PollEvent() tcell.Event {
+	for {
+		event := s.Screen.PollEvent()
+		mouse, ok := event.(*tcell.EventMouse)
+		if !ok {
+			return event
+		}
+
+		s.ui.app.QueueUpdateDraw(func() {
+			s.ui.handleMouse(mouse)
+		})
+	}
+}
+
+// selection 记录鼠标拖动选中的屏幕区域，以行优先的顺序从 begin 到 end
+type selection struct {
+	active     bool
+	moved      bool
+	beginX     int
+	beginY     int
+	endX, endY int
+}
+
+// ordered 返回按屏幕阅读顺序排列的起止位置
+func (s *selection) ordered() (x1, y1, x2, y2 int) {
+	if s.beginY < s.endY || s.beginY == s.endY && s.beginX <= s.endX {
+		return s.beginX, s.beginY, s.endX, s.endY
+	}
+	return s.endX, s.endY, s.beginX, s.beginY
+}
+
+func (s *selection) contains(x, y int) bool {
+	x1, y1, x2, y2 := s.ordered()
+	if y < y1 || y > y2 {
+		return false
+	}
+	if y == y1 && x < x1 || y == y2 && x > x2 {
+		return false
+	}
+	return true
+}
+
+// enableMouse 创建一个启用了鼠标的屏幕交给 tview 使用，失败时退回 tview 默认的屏幕
+func (ui *UI) enableMouse() {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return
+	}
+	if err = screen.Init(); err != nil {
+		return
+	}
+
+	screen.EnableMouse()
+	ui.screen = screen
+	ui.app.SetScreen(&mouseScreen{Screen: screen, ui: ui})
+	ui.app.SetAfterDrawFunc(ui.drawSelection)
+}
+
+// handleMouse 处理鼠标事件，必须在 tview 的事件循环中调用
+func (ui *UI) handleMouse(event *tcell.EventMouse) {
+	x, y := event.Position()
+	buttons := event.Buttons()
+
+	switch {
+	case buttons&tcell.WheelUp != 0:
+		ui.wheel(x, y, -wheelLines)
+	case buttons&tcell.WheelDown != 0:
+		ui.wheel(x, y, wheelLines)
+	case buttons&tcell.Button1 != 0:
+		if !ui.sel.active {
+			ui.sel = selection{active: true, beginX: x, beginY: y, endX: x, endY: y}
+		} else if x != ui.sel.endX || y != ui.sel.endY {
+			ui.sel.endX, ui.sel.endY = x, y
+			ui.sel.moved = true
+		}
+	case buttons == tcell.ButtonNone && ui.sel.active:
+		ui.sel.active = false
+		if ui.sel.moved {
+			ui.copyToClipboard(ui.selectedText())
+		} else if word := ui.wordAt(x, y); word != "" {
+			ui.insertWord(word)
+		}
+	}
+}
+
+// wheel 滚动鼠标所在位置的窗口，在主窗口上向上滚动时进入历史查看模式
+func (ui *UI) wheel(x, y, lines int) {
+	ui.Lock()
+	for _, w := range ui.windows {
+		if !w.config.Hidden && inRect(w.tv, x, y) {
+			w.scroll(lines)
+			ui.Unlock()
+			return
+		}
+	}
+	ui.Unlock()
+
+	if !inRect(ui.pages, x, y) {
+		return
+	}
+
+	if lines < 0 {
+		ui.scroll(func() { ui.pageUp(-lines) })
+	} else {
+		ui.pageDown(lines)
+	}
+}
+
+func inRect(p tview.Primitive, x, y int) bool {
+	px, py, width, height := p.GetRect()
+	return x >= px && x < px+width && y >= py && y < py+height
+}
+
+// drawSelection 以反显的方式标出选中的区域
+func (ui *UI) drawSelection(screen tcell.Screen) {
+	if !ui.sel.active || !ui.sel.moved {
+		return
+	}
+
+	width, height := screen.Size()
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if ui.sel.contains(x, y) {
+				mainc, combc, style, _ := screen.GetContent(x, y)
+				screen.SetContent(x, y, mainc, combc, style.Reverse(true))
+			}
+		}
+	}
+}
+
+// screenLine 返回屏幕上第 y 行的内容，以及每个字符所在的列
+func (ui *UI) screenLine(y int) (runes []rune, columns []int) {
+	width, _ := ui.screen.Size()
+	for x := 0; x < width; {
+		mainc, _, _, w := ui.screen.GetContent(x, y)
+		if mainc == 0 {
+			mainc = ' '
+		}
+		runes = append(runes, mainc)
+		columns = append(columns, x)
+		if w < 1 {
+			w = 1
+		}
+		x += w
+	}
+
+	return runes, columns
+}
+
+// selectedText 返回选中区域中的文字，每行末尾的空白会被去掉
+func (ui *UI) selectedText() string {
+	x1, y1, x2, y2 := ui.sel.ordered()
+	lines := make([]string, 0, y2-y1+1)
+	for y := y1; y <= y2; y++ {
+		runes, columns := ui.screenLine(y)
+		var line []rune
+		for i, r := range runes {
+			x := columns[i]
+			if (y == y1 && x < x1) || (y == y2 && x > x2) {
+				continue
+			}
+			line = append(line, r)
+		}
+		lines = append(lines, strings.TrimRight(string(line), " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// wordAt 返回屏幕上 (x, y) 处的单词。英文单词由字母、数字及 _'- 组成，
+// 中文则取连续的汉字。
+func (ui *UI) wordAt(x, y int) string {
+	if !inRect(ui.pages, x, y) {
+		return ""
+	}
+
+	runes, columns := ui.screenLine(y)
+	pos := -1
+	for i := range runes {
+		if columns[i] <= x {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return ""
+	}
+
+	class := runeClass(runes[pos])
+	if class == 0 {
+		return ""
+	}
+
+	begin, end := pos, pos+1
+	for begin > 0 && runeClass(runes[begin-1]) == class {
+		begin--
+	}
+	for end < len(runes) && runeClass(runes[end]) == class {
+		end++
+	}
+
+	return string(runes[begin:end])
+}
+
+// runeClass 区分单词字符的类别：1 为英文单词字符，2 为汉字等其它文字，0 为非单词字符
+func runeClass(r rune) int {
+	switch {
+	case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_'-", r)):
+		return 1
+	case r >= unicode.MaxASCII && unicode.IsLetter(r):
+		return 2
+	default:
+		return 0
+	}
+}
+
+// insertWord 把单词插入到命令行的光标处，必要时在前面加一个空格
+func (ui *UI) insertWord(word string) {
+	before := ui.cmdLine.GetText()[:ui.cmdLine.Cursor()]
+	if before != "" && !strings.HasSuffix(before, " ") {
+		word = " " + word
+	}
+
+	ui.cmdLine.Insert(word)
+	ui.app.SetFocus(ui.cmdLine)
+}
+
+// copyToClipboard 通过 OSC 52 控制序列把文字复制到终端的剪贴板。
+// 控制序列写到 tcell 所使用的终端上，写入时持有 tcell 屏幕的锁，以免与 tcell 正在输出的内容交错。
+func (ui *UI) copyToClipboard(text string) {
+	if text == "" || ui.screen == nil {
+		return
+	}
+
+	// Windows 控制台不支持 OSC 52，优先使用系统的剪贴板
+	if runtime.GOOS == "windows" && setSystemClipboard(text) == nil {
+		return
+	}
+
+	seq := fmt.Sprintf("\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+
+	if locker, ok := ui.screen.(sync.Locker); ok {
+		locker.Lock()
+		defer locker.Unlock()
+	}
+
+	// tcell 在类 Unix 系统上直接打开 /dev/tty 进行输出，其它系统上则使用标准输出
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		_, _ = io.WriteString(os.Stdout, seq)
+		return
+	}
+	defer tty.Close()
+
+	_, _ = io.WriteString(tty, seq)
+}
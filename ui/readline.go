@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/gdamore/tcell"
@@ -18,6 +20,30 @@ type Readline struct {
 
 	repeat   bool
 	autoTrim bool
+	secret   bool
+
+	// 前缀过滤的历史浏览：prefix 为开始浏览时已输入的内容，
+	// shown 为最近一次从历史记录中填入的内容，用来判断用户是否修改过输入。
+	prefix string
+	shown  string
+
+	// 增量搜索：searchDir 为 0 表示未在搜索，-1 为反向搜索，1 为正向搜索
+	searchDir  int
+	searchText string
+	searchPos  int
+	searchFail bool
+	savedText  string
+	savedLabel string
+
+	// Tab 补全：completed、complCursor 为最近一次补全后的完整内容及光标位置，用来判断是否为连续的 Tab
+	completer   func(word string) []string
+	candidates  []string
+	candIndex   int
+	complBase   string
+	complWord   string
+	complRest   string
+	completed   string
+	complCursor int
 }
 
 func NewReadline() *Readline {
@@ -39,26 +65,53 @@ func (r *Readline) SetAutoTrim(b bool) *Readline {
 	return r
 }
 
+// SetSecret 开启或关闭密码模式。密码模式下输入内容以星号显示，且不会进入历史记录。
+func (r *Readline) SetSecret(b bool) *Readline {
+	r.secret = b
+	if b {
+		r.InputField.SetMaskCharacter('*')
+	} else {
+		r.InputField.SetMaskCharacter(0)
+	}
+	return r
+}
+
+func (r *Readline) IsSecret() bool {
+	return r.secret
+}
+
+// SetCompleter 设置 Tab 补全的候选词来源，word 为光标前正在输入的单词
+func (r *Readline) SetCompleter(completer func(word string) []string) *Readline {
+	r.completer = completer
+	return r
+}
+
 func (r *Readline) InputCapture(event *tcell.EventKey) *tcell.EventKey {
+	if r.searchDir != 0 {
+		return r.searchInputCapture(event)
+	}
+
 	switch event.Key() {
 	case tcell.KeyCtrlC:
 		r.InputField.SetText("")
 		return nil
 	case tcell.KeyUp:
-		if r.curSel > 0 {
-			r.curSel--
-			r.InputField.SetText(r.history[r.curSel])
-		}
+		r.historyPrev()
 		return nil
 	case tcell.KeyDown:
-		if r.curSel == len(r.history)-1 {
-			r.curSel++
-			r.InputField.SetText("")
-		}
-		if r.curSel < len(r.history)-1 {
-			r.curSel++
-			r.InputField.SetText(r.history[r.curSel])
-		}
+		r.historyNext()
+		return nil
+	case tcell.KeyCtrlR:
+		r.startSearch(-1)
+		return nil
+	case tcell.KeyCtrlS:
+		r.startSearch(1)
+		return nil
+	case tcell.KeyTab:
+		r.complete(1)
+		return nil
+	case tcell.KeyBacktab:
+		r.complete(-1)
 		return nil
 	default:
 	}
@@ -66,9 +119,243 @@ func (r *Readline) InputCapture(event *tcell.EventKey) *tcell.EventKey {
 	return event
 }
 
+// complete 补全光标前的单词，连续按 Tab 时在候选词之间循环，最后回到原来的输入
+func (r *Readline) complete(step int) {
+	if r.secret || r.completer == nil {
+		return
+	}
+
+	text := r.InputField.GetText()
+	cursor := r.Cursor()
+	if text != r.completed || cursor != r.complCursor || len(r.candidates) == 0 {
+		before := text[:cursor]
+		word := before[strings.LastIndexAny(before, " \t")+1:]
+		if word == "" {
+			return
+		}
+
+		r.complBase = before[:len(before)-len(word)]
+		r.complWord = word
+		r.complRest = text[cursor:]
+		r.candidates = r.completer(word)
+		r.candIndex = len(r.candidates)
+		if len(r.candidates) == 0 {
+			return
+		}
+	}
+
+	// candIndex 等于 len(r.candidates) 时表示原来的输入
+	count := len(r.candidates) + 1
+	r.candIndex = (r.candIndex + step + count) % count
+
+	word := r.complWord
+	if r.candIndex < len(r.candidates) {
+		word = r.candidates[r.candIndex]
+	}
+
+	r.completed = r.complBase + word + r.complRest
+	r.complCursor = len(r.complBase + word)
+	r.setText(r.completed, r.complCursor)
+}
+
+// Cursor 返回光标在输入内容中的位置（字节数）。
+// 这个版本的 InputField 没有提供读取光标位置的方法，只能通过反射读取，
+// 读不到时（例如 tview 改了字段名）当作光标在末尾。
+func (r *Readline) Cursor() int {
+	text := r.InputField.GetText()
+	field := reflect.ValueOf(r.InputField).Elem().FieldByName("cursorPos")
+	if !field.IsValid() || field.Kind() != reflect.Int {
+		return len(text)
+	}
+
+	pos := int(field.Int())
+	if pos < 0 || pos > len(text) {
+		return len(text)
+	}
+
+	return pos
+}
+
+// Insert 在光标处插入 text。InputField 没有设置光标位置的方法，所以像用户输入一样逐个字符插入
+func (r *Readline) Insert(text string) {
+	for _, c := range text {
+		r.sendKey(tcell.NewEventKey(tcell.KeyRune, c, tcell.ModNone))
+	}
+}
+
+// setText 把输入内容设置为 text，并把光标放在 cursor 处
+func (r *Readline) setText(text string, cursor int) {
+	r.InputField.SetText(text[cursor:])
+	r.sendKey(tcell.NewEventKey(tcell.KeyHome, 0, tcell.ModNone))
+	r.Insert(text[:cursor])
+}
+
+func (r *Readline) sendKey(event *tcell.EventKey) {
+	r.InputField.InputHandler()(event, func(tview.Primitive) {})
+}
+
+// historyPrev 向前查找以 prefix 开头的历史命令
+func (r *Readline) historyPrev() {
+	if text := r.InputField.GetText(); text != r.shown {
+		// 用户修改过输入，以当前内容作为新的前缀重新开始
+		r.prefix = text
+		r.curSel = len(r.history)
+	}
+
+	for i := r.curSel - 1; i >= 0; i-- {
+		if strings.HasPrefix(r.history[i], r.prefix) {
+			r.curSel = i
+			r.showHistory(r.history[i])
+			return
+		}
+	}
+}
+
+// historyNext 向后查找以 prefix 开头的历史命令，找不到时恢复为 prefix 本身
+func (r *Readline) historyNext() {
+	if r.InputField.GetText() != r.shown {
+		return
+	}
+
+	for i := r.curSel + 1; i < len(r.history); i++ {
+		if strings.HasPrefix(r.history[i], r.prefix) {
+			r.curSel = i
+			r.showHistory(r.history[i])
+			return
+		}
+	}
+
+	r.curSel = len(r.history)
+	r.showHistory(r.prefix)
+}
+
+func (r *Readline) showHistory(text string) {
+	r.shown = text
+	r.InputField.SetText(text)
+}
+
+func (r *Readline) resetHistory() {
+	r.curSel = len(r.history)
+	r.prefix = ""
+	r.shown = ""
+	r.candidates = nil
+	r.completed = ""
+}
+
+func (r *Readline) startSearch(dir int) {
+	if r.secret {
+		return
+	}
+
+	r.searchDir = dir
+	r.searchText = ""
+	r.searchPos = r.curSel
+	r.searchFail = false
+	r.savedText = r.InputField.GetText()
+	r.savedLabel = r.InputField.GetLabel()
+	r.updateSearchLabel()
+}
+
+// stopSearch 结束增量搜索，accept 为 false 时恢复搜索前的输入
+func (r *Readline) stopSearch(accept bool) {
+	if r.searchDir == 0 {
+		return
+	}
+
+	r.searchDir = 0
+	r.InputField.SetLabel(r.savedLabel)
+
+	text := r.savedText
+	if accept {
+		text = r.InputField.GetText()
+		r.curSel = r.searchPos
+		r.shown = text
+		r.prefix = ""
+	}
+
+	// 重新设置一次文本，以便触发 ChangedFunc 更新提示符
+	r.InputField.SetText(text)
+}
+
+func (r *Readline) searchInputCapture(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyCtrlR:
+		r.searchDir = -1
+		r.search(r.searchPos - 1)
+	case tcell.KeyCtrlS:
+		r.searchDir = 1
+		r.search(r.searchPos + 1)
+	case tcell.KeyRune:
+		r.searchText += string(event.Rune())
+		r.search(r.searchPos)
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(r.searchText) > 0 {
+			runes := []rune(r.searchText)
+			r.searchText = string(runes[:len(runes)-1])
+		}
+		r.searchPos = r.curSel
+		r.search(r.searchPos)
+	case tcell.KeyCtrlC, tcell.KeyCtrlG, tcell.KeyEscape:
+		r.stopSearch(false)
+	default:
+		// 其它按键一律结束搜索并接受当前匹配，然后按正常按键处理
+		r.stopSearch(true)
+		return r.InputCapture(event)
+	}
+
+	return nil
+}
+
+// search 从 from 开始按 searchDir 方向查找包含 searchText 的历史命令
+func (r *Readline) search(from int) {
+	r.searchFail = false
+	if r.searchText == "" {
+		r.updateSearchLabel()
+		return
+	}
+
+	if from >= len(r.history) {
+		from = len(r.history) - 1
+	} else if from < 0 {
+		from = 0
+	}
+
+	for i := from; i >= 0 && i < len(r.history); i += r.searchDir {
+		if strings.Contains(r.history[i], r.searchText) {
+			r.searchPos = i
+			r.InputField.SetText(r.history[i])
+			r.updateSearchLabel()
+			return
+		}
+	}
+
+	r.searchFail = true
+	r.updateSearchLabel()
+}
+
+func (r *Readline) updateSearchLabel() {
+	label := "reverse-i-search"
+	if r.searchDir > 0 {
+		label = "i-search"
+	}
+	if r.searchFail {
+		label = "failed " + label
+	}
+
+	r.InputField.SetLabel(fmt.Sprintf("(%s)`%s': ", label, r.searchText))
+}
+
 func (r *Readline) Enter() string {
+	r.stopSearch(true)
+	defer r.resetHistory()
+
 	text := r.InputField.GetText()
 
+	if r.secret {
+		r.InputField.SetText("")
+		return text
+	}
+
 	if text != "" && r.autoTrim {
 		text = strings.TrimSpace(text)
 		// 如果 trim 之后变成了空串，则至少保留一个空格，以免用户发不出空格
@@ -89,7 +376,6 @@ func (r *Readline) Enter() string {
 			r.history = r.history[1 : len(r.history)-1]
 		}
 		r.history = append(r.history, text)
-		r.curSel = len(r.history)
 	}
 
 	r.InputField.SetText("")
@@ -0,0 +1,200 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+// newTestReadline 返回一个依次输入过 history 中各条命令的 Readline
+func newTestReadline(history ...string) *Readline {
+	r := NewReadline()
+	for _, cmd := range history {
+		r.SetText(cmd)
+		r.Enter()
+	}
+	return r
+}
+
+// press 像界面的事件循环一样把按键交给 r 处理，keys 中的字符串表示依次输入其中的字符
+func press(r *Readline, keys ...interface{}) {
+	for _, key := range keys {
+		var events []*tcell.EventKey
+		switch key := key.(type) {
+		case string:
+			for _, c := range key {
+				events = append(events, tcell.NewEventKey(tcell.KeyRune, c, tcell.ModNone))
+			}
+		case tcell.Key:
+			events = append(events, tcell.NewEventKey(key, 0, tcell.ModNone))
+		}
+
+		for _, event := range events {
+			if event = r.InputCapture(event); event != nil {
+				r.sendKey(event)
+			}
+		}
+	}
+}
+
+func TestReadlineHistory(t *testing.T) {
+	history := []string{"look", "hp", "kill rat", "hp -v", "say hi"}
+
+	tests := []struct {
+		name string
+		keys []interface{}
+		want string
+	}{
+		{"上一条", []interface{}{tcell.KeyUp}, "say hi"},
+		{"上两条", []interface{}{tcell.KeyUp, tcell.KeyUp}, "hp -v"},
+		{"到头之后不动", []interface{}{tcell.KeyUp, tcell.KeyUp, tcell.KeyUp, tcell.KeyUp, tcell.KeyUp, tcell.KeyUp}, "look"},
+		{"下一条", []interface{}{tcell.KeyUp, tcell.KeyUp, tcell.KeyDown}, "say hi"},
+		{"最后回到空行", []interface{}{tcell.KeyUp, tcell.KeyDown}, ""},
+		{"按前缀查找", []interface{}{"h", tcell.KeyUp}, "hp -v"},
+		{"按前缀继续查找", []interface{}{"h", tcell.KeyUp, tcell.KeyUp}, "hp"},
+		{"前缀没有更多匹配", []interface{}{"h", tcell.KeyUp, tcell.KeyUp, tcell.KeyUp}, "hp"},
+		{"按前缀向后查找", []interface{}{"h", tcell.KeyUp, tcell.KeyUp, tcell.KeyDown}, "hp -v"},
+		{"向后查找时恢复前缀", []interface{}{"h", tcell.KeyUp, tcell.KeyDown}, "h"},
+		{"没有匹配的前缀", []interface{}{"x", tcell.KeyUp}, "x"},
+		{"修改后以新内容为前缀", []interface{}{tcell.KeyUp, tcell.KeyUp, tcell.KeyBackspace2, tcell.KeyBackspace2, tcell.KeyBackspace2, "!", tcell.KeyUp}, "hp!"},
+		{"修改后从最新的命令开始查找", []interface{}{tcell.KeyUp, tcell.KeyUp, tcell.KeyUp, tcell.KeyBackspace2, tcell.KeyBackspace2, tcell.KeyBackspace2, tcell.KeyBackspace2, tcell.KeyUp}, "kill rat"},
+		{"修改后向后查找不起作用", []interface{}{tcell.KeyUp, "!", tcell.KeyDown}, "say hi!"},
+	}
+
+	for _, tt := range tests {
+		r := newTestReadline(history...)
+		press(r, tt.keys...)
+		if got := r.GetText(); got != tt.want {
+			t.Errorf("%s: text = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadlineEnter(t *testing.T) {
+	tests := []struct {
+		name     string
+		repeat   bool
+		autoTrim bool
+		inputs   []string
+		sent     []string
+		history  []string
+	}{
+		{"普通输入", false, false, []string{"a", "b"}, []string{"a", "b"}, []string{"a", "b"}},
+		{"相邻的重复命令只记录一次", false, false, []string{"a", "a", "b", "a"}, []string{"a", "a", "b", "a"}, []string{"a", "b", "a"}},
+		{"空行重复上一条命令", true, false, []string{"a", ""}, []string{"a", "a"}, []string{"a"}},
+		{"不重复时发送空行", false, false, []string{"a", ""}, []string{"a", ""}, []string{"a", ""}},
+		{"去掉首尾空白", false, true, []string{" a ", "  "}, []string{"a", " "}, []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		r := NewReadline().SetRepeat(tt.repeat).SetAutoTrim(tt.autoTrim)
+
+		var sent []string
+		for _, input := range tt.inputs {
+			r.SetText(input)
+			sent = append(sent, r.Enter())
+		}
+
+		if strings.Join(sent, "|") != strings.Join(tt.sent, "|") {
+			t.Errorf("%s: sent %q, want %q", tt.name, sent, tt.sent)
+		}
+		if strings.Join(r.history, "|") != strings.Join(tt.history, "|") {
+			t.Errorf("%s: history %q, want %q", tt.name, r.history, tt.history)
+		}
+	}
+}
+
+func TestReadlineSecret(t *testing.T) {
+	r := newTestReadline("look")
+	r.SetSecret(true)
+	r.SetText("password")
+	if got := r.Enter(); got != "password" {
+		t.Errorf("Enter() = %q, want %q", got, "password")
+	}
+
+	press(r, tcell.KeyUp)
+	if got := r.GetText(); got != "look" {
+		t.Errorf("password should not be in history, got %q", got)
+	}
+}
+
+func TestReadlineSearch(t *testing.T) {
+	history := []string{"look", "kill rat", "hp", "kill dog", "say hi"}
+
+	tests := []struct {
+		name   string
+		keys   []interface{}
+		want   string
+		label  string // 搜索中的提示符，空串表示已经结束搜索
+		cursel int    // 结束搜索后历史浏览的位置，-1 表示不检查
+	}{
+		{"开始反向搜索", []interface{}{tcell.KeyCtrlR}, "", "(reverse-i-search)`': ", -1},
+		{"增量搜索", []interface{}{tcell.KeyCtrlR, "kill"}, "kill dog", "(reverse-i-search)`kill': ", -1},
+		{"继续反向搜索", []interface{}{tcell.KeyCtrlR, "kill", tcell.KeyCtrlR}, "kill rat", "(reverse-i-search)`kill': ", -1},
+		{"搜索失败时保留上一个匹配", []interface{}{tcell.KeyCtrlR, "kill", tcell.KeyCtrlR, tcell.KeyCtrlR}, "kill rat", "(failed reverse-i-search)`kill': ", -1},
+		{"改为正向搜索", []interface{}{tcell.KeyCtrlR, "kill", tcell.KeyCtrlR, tcell.KeyCtrlS}, "kill dog", "(i-search)`kill': ", -1},
+		{"删除搜索内容", []interface{}{tcell.KeyCtrlR, "killx", tcell.KeyBackspace2}, "kill dog", "(reverse-i-search)`kill': ", -1},
+		{"取消时恢复原来的输入", []interface{}{"abc", tcell.KeyCtrlR, "kill", tcell.KeyEscape}, "abc", "", -1},
+		{"其它按键接受匹配", []interface{}{tcell.KeyCtrlR, "kill", tcell.KeyCtrlR, tcell.KeyEnd}, "kill rat", "", 1},
+		{"接受后从匹配处继续浏览历史", []interface{}{tcell.KeyCtrlR, "kill", tcell.KeyCtrlR, tcell.KeyUp}, "look", "", 0},
+	}
+
+	for _, tt := range tests {
+		r := newTestReadline(history...)
+		r.SetLabel("> ")
+		press(r, tt.keys...)
+
+		if got := r.GetText(); got != tt.want {
+			t.Errorf("%s: text = %q, want %q", tt.name, got, tt.want)
+		}
+
+		label := tt.label
+		if label == "" {
+			label = "> "
+		}
+		if got := r.GetLabel(); got != label {
+			t.Errorf("%s: label = %q, want %q", tt.name, got, label)
+		}
+
+		if tt.cursel >= 0 && r.curSel != tt.cursel {
+			t.Errorf("%s: curSel = %d, want %d", tt.name, r.curSel, tt.cursel)
+		}
+	}
+}
+
+func TestReadlineComplete(t *testing.T) {
+	words := []string{"kill", "kiss", "look"}
+	completer := func(word string) []string {
+		var result []string
+		for _, w := range words {
+			if strings.HasPrefix(w, word) {
+				result = append(result, w)
+			}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		keys   []interface{}
+		want   string
+		cursor int
+	}{
+		{"补全第一个候选词", []interface{}{"ki", tcell.KeyTab}, "kill", 4},
+		{"循环候选词", []interface{}{"ki", tcell.KeyTab, tcell.KeyTab}, "kiss", 4},
+		{"最后回到原来的输入", []interface{}{"ki", tcell.KeyTab, tcell.KeyTab, tcell.KeyTab}, "ki", 2},
+		{"反向循环", []interface{}{"ki", tcell.KeyBacktab}, "kiss", 4},
+		{"补全光标前的单词", []interface{}{"get lo rat", tcell.KeyLeft, tcell.KeyLeft, tcell.KeyLeft, tcell.KeyLeft, tcell.KeyTab}, "get look rat", 8},
+		{"没有候选词", []interface{}{"x", tcell.KeyTab}, "x", 1},
+		{"光标前是空格", []interface{}{"ki ", tcell.KeyTab}, "ki ", 3},
+	}
+
+	for _, tt := range tests {
+		r := NewReadline().SetCompleter(completer)
+		press(r, tt.keys...)
+		if got, cursor := r.GetText(), r.Cursor(); got != tt.want || cursor != tt.cursor {
+			t.Errorf("%s: text = %q, cursor = %d, want %q, %d", tt.name, got, cursor, tt.want, tt.cursor)
+		}
+	}
+}
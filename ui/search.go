@@ -0,0 +1,181 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell"
+
+	"github.com/mudclient/go-mud/ansi"
+)
+
+// 历史查看模式下的搜索功能：
+//     /pattern 向下搜索，?pattern 向上搜索，n/N 沿相同/相反方向查找下一个。
+// pattern 为正则表达式，匹配的是去掉了 ANSI 控制码的纯文本。
+
+func (ui *UI) isSearchPrompting() bool {
+	ui.Lock()
+	defer ui.Unlock()
+
+	return ui.searchPrompt != 0
+}
+
+func (ui *UI) startSearchPrompt(prompt rune) {
+	ui.Lock()
+	defer ui.Unlock()
+
+	ui.searchPrompt = prompt
+	ui.searchInput = ui.searchInput[:0]
+	ui.drawHistory()
+}
+
+func (ui *UI) searchInputCapture(event *tcell.EventKey) {
+	ui.Lock()
+	defer ui.Unlock()
+
+	switch event.Key() {
+	case tcell.KeyRune:
+		ui.searchInput = append(ui.searchInput, event.Rune())
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(ui.searchInput) == 0 {
+			ui.searchPrompt = 0
+		} else {
+			ui.searchInput = ui.searchInput[:len(ui.searchInput)-1]
+		}
+	case tcell.KeyCtrlC, tcell.KeyEscape:
+		ui.searchPrompt = 0
+	case tcell.KeyEnter:
+		ui.searchBack = ui.searchPrompt == '?'
+		ui.searchPrompt = 0
+		pattern := string(ui.searchInput)
+		if pattern == "" && ui.searchRe != nil {
+			// 空的搜索串表示沿用上一次的正则
+			ui.search(ui.searchBack)
+			break
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			ui.searchMsg = fmt.Sprintf("正则表达式有误: %v", err)
+			break
+		}
+
+		ui.searchRe = re
+		ui.searchLine = -1
+		ui.search(ui.searchBack)
+		return
+	}
+
+	ui.drawHistory()
+}
+
+// Search 进入历史查看模式并搜索 pattern，backward 为 true 时向上搜索
+func (ui *UI) Search(pattern string, backward bool) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	ui.app.QueueUpdateDraw(func() {
+		ui.scroll(func() {
+			ui.Lock()
+			defer ui.Unlock()
+
+			ui.searchRe = re
+			ui.searchBack = backward
+			ui.searchLine = -1
+			ui.search(backward)
+		})
+	})
+	return nil
+}
+
+// searchNext 查找下一个匹配，reverse 为 true 时与上一次搜索的方向相反
+func (ui *UI) searchNext(reverse bool) {
+	ui.Lock()
+	defer ui.Unlock()
+
+	if !ui.scrolling {
+		return
+	}
+
+	if ui.searchRe == nil {
+		ui.searchMsg = "还没有搜索过任何内容"
+		ui.drawHistory()
+		return
+	}
+
+	ui.search(ui.searchBack != reverse)
+}
+
+// search 从当前匹配行（或当前屏幕）开始查找下一个匹配行，找到结尾时回绕，调用者需持有锁。
+// 最后 RTTVHeight 行显示在实时文本区域中，历史区域不会显示它们，所以不在搜索范围之内。
+func (ui *UI) search(backward bool) {
+	_, _, _, height := ui.historyTV.GetInnerRect()
+	count := len(ui.buffer) - ui.config.RTTVHeight
+	if count <= 0 {
+		ui.searchMsg = fmt.Sprintf("找不到 %s", ui.searchRe)
+		ui.drawHistory()
+		return
+	}
+
+	start := ui.searchLine
+	if start < ui.offset || start >= ui.offset+height {
+		// 上一次的匹配行已经不在屏幕上了，从当前屏幕开始搜索
+		start = ui.offset - 1
+		if backward {
+			start = ui.offset + height
+		}
+	}
+
+	step := 1
+	if backward {
+		step = -1
+	}
+
+	for i := 1; i <= count; i++ {
+		line := ((start+step*i)%count + count) % count
+		text := ui.buffer[line].display(ui.timestamp)
+		if ui.searchRe.MatchString(ansi.Strip(text)) {
+			ui.searchLine = line
+			ui.searchMsg = fmt.Sprintf("第 %d 行匹配 %s", line, ui.searchRe)
+			if wrapped := (line-start)*step < 0; wrapped {
+				ui.searchMsg += "（已回绕）"
+			}
+			ui.offset = line - height/2
+			ui.drawHistory()
+			return
+		}
+	}
+
+	ui.searchMsg = fmt.Sprintf("找不到 %s", ui.searchRe)
+	ui.drawHistory()
+}
+
+// highlightMatches 以反显的方式标记出 line 中匹配 re 的部分。
+// 匹配是在去掉 ANSI 控制码后的纯文本上进行的，标记则插入到原文的相应位置。
+func highlightMatches(line string, re *regexp.Regexp) string {
+	plain, index := ansi.Index(line)
+	matches := re.FindAllStringIndex(plain, -1)
+	if matches == nil {
+		return line
+	}
+
+	var result strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m[0] == m[1] {
+			continue
+		}
+		begin, end := index[m[0]], index[m[1]-1]+1
+		result.WriteString(line[last:begin])
+		result.WriteString("\x1b[7m")
+		result.WriteString(line[begin:end])
+		result.WriteString("\x1b[27m")
+		last = end
+	}
+	result.WriteString(line[last:])
+
+	return result.String()
+}
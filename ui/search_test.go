@@ -0,0 +1,83 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/rivo/tview"
+)
+
+func TestHighlightMatches(t *testing.T) {
+	tests := []struct {
+		line    string
+		pattern string
+		want    string
+	}{
+		{"hello", "x", "hello"},
+		{"hello", "l+", "he\x1b[7mll\x1b[27mo"},
+		{"a1b2", `\d`, "a\x1b[7m1\x1b[27mb\x1b[7m2\x1b[27m"},
+		{"\x1b[31mhp\x1b[0m 100", "hp", "\x1b[31m\x1b[7mhp\x1b[27m\x1b[0m 100"},
+		{"h\x1b[1mp", "hp", "\x1b[7mh\x1b[1mp\x1b[27m"},
+		{"ab", "x*", "ab"},
+	}
+
+	for _, tt := range tests {
+		if got := highlightMatches(tt.line, regexp.MustCompile(tt.pattern)); got != tt.want {
+			t.Errorf("highlightMatches(%q, %q) = %q, want %q", tt.line, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// newSearchUI 返回一个历史区域高 4 行、共有 20 行历史记录的 UI，其中第 3、10、18 行包含 hp，
+// 最后 2 行显示在实时文本区域中
+func newSearchUI() *UI {
+	ui := NewUI(Config{RTTVHeight: 2})
+	ui.historyTV = tview.NewTextView()
+	ui.historyTV.SetRect(0, 0, 80, 4)
+	ui.sepLine = tview.NewTextView()
+	ui.scrolling = true
+
+	for i := 0; i < 20; i++ {
+		text := fmt.Sprintf("line %d", i)
+		if i == 3 || i == 10 || i == 18 {
+			text += " hp"
+		}
+		ui.buffer = append(ui.buffer, Line{Text: text})
+	}
+
+	return ui
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		offset   int
+		searches []bool // 依次搜索的方向，true 为向上
+		line     int
+		msg      string
+	}{
+		{"向上搜索", "hp", 14, []bool{true}, 10, "第 10 行匹配 hp"},
+		{"继续向上搜索", "hp", 14, []bool{true, true}, 3, "第 3 行匹配 hp"},
+		{"向上搜索回绕", "hp", 14, []bool{true, true, true}, 10, "第 10 行匹配 hp（已回绕）"},
+		{"向下搜索不包括实时文本区域", "hp", 14, []bool{false}, 3, "第 3 行匹配 hp（已回绕）"},
+		{"从当前屏幕向下搜索", "hp", 0, []bool{false, false}, 10, "第 10 行匹配 hp"},
+		{"改变方向", "hp", 14, []bool{true, true, false}, 10, "第 10 行匹配 hp"},
+		{"找不到", "mp", 14, []bool{true}, -1, "找不到 mp"},
+	}
+
+	for _, tt := range tests {
+		ui := newSearchUI()
+		ui.offset = tt.offset
+		ui.searchRe = regexp.MustCompile(tt.pattern)
+		ui.searchLine = -1
+		for _, backward := range tt.searches {
+			ui.search(backward)
+		}
+
+		if ui.searchLine != tt.line || ui.searchMsg != tt.msg {
+			t.Errorf("%s: line = %d, msg = %q, want %d, %q", tt.name, ui.searchLine, ui.searchMsg, tt.line, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/tview"
+)
+
+const (
+	defaultGaugeWidth = 10
+	maxStatusLines    = 3
+)
+
+// statusField 是状态栏中的一个字段，gaugeMax 大于 0 时以进度条的形式显示
+type statusField struct {
+	name  string
+	text  string
+	color string
+	line  int
+
+	gaugeCur   int
+	gaugeMax   int
+	gaugeWidth int
+}
+
+func (f *statusField) String() string {
+	color := f.color
+	if color == "" {
+		color = "-"
+	}
+
+	if f.gaugeMax <= 0 {
+		return fmt.Sprintf("[%s]%s[-]", color, tview.Escape(f.text))
+	}
+
+	// 进度条以背景色表示，文字叠加在进度条上
+	text := f.text
+	if text == "" {
+		text = fmt.Sprintf("%d/%d", f.gaugeCur, f.gaugeMax)
+	}
+	text = runewidth.FillRight(runewidth.Truncate(text, f.gaugeWidth, ""), f.gaugeWidth)
+
+	filled := f.gaugeCur * f.gaugeWidth / f.gaugeMax
+	if filled < 0 {
+		filled = 0
+	} else if filled > f.gaugeWidth {
+		filled = f.gaugeWidth
+	}
+
+	var bar strings.Builder
+	width := 0
+	fmt.Fprintf(&bar, "[white:%s]", color)
+	for _, r := range text {
+		if width == filled {
+			bar.WriteString("[white:darkgray]")
+		}
+		bar.WriteString(tview.Escape(string(r)))
+		width += runewidth.RuneWidth(r)
+	}
+	if width == filled {
+		bar.WriteString("[white:darkgray]")
+	}
+	bar.WriteString("[-:-]")
+
+	return bar.String()
+}
+
+// SetStatus 设置状态栏字段的内容，line 为字段所在的状态栏行号，从 1 开始，最多 maxStatusLines 行
+func (ui *UI) SetStatus(name, text, color string, line int) {
+	ui.setStatusField(name, line, func(f *statusField) {
+		f.text = text
+		f.color = color
+		f.gaugeMax = 0
+	})
+}
+
+// SetGauge 以进度条的形式设置状态栏字段，text 为空时显示 cur/max
+func (ui *UI) SetGauge(name string, cur, max int, text, color string, width, line int) {
+	if width <= 0 {
+		width = defaultGaugeWidth
+	}
+
+	ui.setStatusField(name, line, func(f *statusField) {
+		f.text = text
+		f.color = color
+		f.gaugeCur = cur
+		f.gaugeMax = max
+		f.gaugeWidth = width
+	})
+}
+
+// SetSystemStatus 设置内置的状态栏字段，未在配置中启用的字段会被忽略
+func (ui *UI) SetSystemStatus(name, text, color string) {
+	if !ui.statusBuiltin[name] {
+		return
+	}
+
+	ui.SetStatus(name, text, color, 1)
+}
+
+// DelStatus 删除状态栏字段
+func (ui *UI) DelStatus(name string) {
+	ui.Lock()
+	lines := ui.statusLines()
+	for i, f := range ui.status {
+		if f.name == name {
+			ui.status = append(ui.status[:i], ui.status[i+1:]...)
+			break
+		}
+	}
+	changed := lines != ui.statusLines()
+	ui.Unlock()
+
+	ui.drawStatus(changed)
+}
+
+// setStatusField 更新或添加状态栏字段，内容没有变化时不会重绘
+func (ui *UI) setStatusField(name string, line int, update func(f *statusField)) {
+	if line <= 0 {
+		line = 1
+	} else if line > maxStatusLines {
+		line = maxStatusLines
+	}
+
+	ui.Lock()
+	lines := ui.statusLines()
+	var field *statusField
+	for _, f := range ui.status {
+		if f.name == name {
+			field = f
+			break
+		}
+	}
+	old := ""
+	if field == nil {
+		field = &statusField{name: name}
+		ui.status = append(ui.status, field)
+	} else if field.line == line {
+		old = field.String()
+	}
+	field.line = line
+	update(field)
+	if old != "" && old == field.String() {
+		ui.Unlock()
+		return
+	}
+	changed := lines != ui.statusLines()
+	ui.Unlock()
+
+	ui.drawStatus(changed)
+}
+
+// statusLines 返回状态栏的行数，调用者需持有锁
+func (ui *UI) statusLines() int {
+	lines := 0
+	for _, f := range ui.status {
+		if f.line > lines {
+			lines = f.line
+		}
+	}
+
+	return lines
+}
+
+// drawStatus 重绘状态栏，状态栏行数发生变化时需要重新布局
+func (ui *UI) drawStatus(relayout bool) {
+	if ui.statusTV == nil {
+		return
+	}
+
+	ui.Lock()
+	lines := make([]string, ui.statusLines())
+	for _, f := range ui.status {
+		if lines[f.line-1] != "" {
+			lines[f.line-1] += " "
+		}
+		lines[f.line-1] += f.String()
+	}
+	ui.Unlock()
+
+	ui.statusTV.SetText(strings.Join(lines, "\n"))
+
+	if relayout {
+		ui.relayout()
+	} else {
+		ui.app.Draw()
+	}
+}
@@ -3,19 +3,57 @@ package ui
 import (
 	"fmt"
 	"io"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/flw-cn/printer"
 	"github.com/gdamore/tcell"
 	"github.com/rivo/tview"
+
+	"github.com/mudclient/go-mud/ansi"
 )
 
 type Config struct {
 	AmbiguousWidth string `flag:"|auto|二义性字符宽度，可选值: auto/single/double/space"`
 	HistoryLines   int    `flag:"|100000|历史记录保留行数"`
 	RTTVHeight     int    `flag:"|10|历史查看模式下实时文本区域高度"`
+	CompleteWords  int    `flag:"|1000|Tab 补全时记忆的最近出现的单词数"`
+	StatusFields   string `flag:"|conn,latency,encoding,clock|状态栏中显示的内置字段，可选值: conn/latency/encoding/clock"`
+	Mouse          bool   `flag:"|false|是否启用鼠标（滚轮翻屏、拖动复制、点击取词），启用后终端自身的选择功能通常需要按住 Shift 键"`
+	Timestamp      bool   `flag:"|false|是否在每行前显示时间戳"`
+	Separator      string `flag:"|;;|命令分隔符，一行中用它隔开的多条命令会依次执行，留空表示不分隔"`
+	Colors         string `flag:"|truecolor|颜色模式，可选值: truecolor/256/16，终端无法显示更多颜色时可降低"`
+	Theme          string `flag:"||配色方案文件，YAML 格式，定义 16 种基本颜色"`
+
+	// Keys 为按键绑定，键为按键名称，值为内置功能名称或者要发送的命令
+	Keys map[string]string
+	// Windows 为附加窗口，用来单独显示聊天等频道的内容
+	Windows []WindowConfig
+	// Palette 为基本颜色，键为颜色名称，值为 #rrggbb，会覆盖配色方案文件中的设置
+	Palette map[string]string
+}
+
+// Line 是历史记录中的一行，Text 中保留了 ANSI 控制码
+type Line struct {
+	Time time.Time
+	Text string
+}
+
+// display 返回用于显示的内容，timestamp 为 true 时在行首加上暗色的时间戳
+func (line Line) display(timestamp bool) string {
+	if !timestamp {
+		return line.Text
+	}
+
+	return timestampPrefix(line.Time) + line.Text
+}
+
+func timestampPrefix(t time.Time) string {
+	return "\x1b[2m" + t.Format("[15:04:05]") + "\x1b[22m "
 }
 
 type UI struct {
@@ -24,33 +62,78 @@ type UI struct {
 
 	config Config
 	app    *tview.Application
+	screen tcell.Screen
+	sel    selection
 
-	ansiWriter io.Writer
+	render     *renderer
+	renderErr  error
+	ansiWriter *ansiWriter
+	root       *tview.Pages
 	pages      *tview.Pages
 	historyTV  *tview.TextView
 	sepLine    *tview.TextView
 	realtimeTV *tview.TextView
 	cmdLine    *Readline
+	statusTV   *tview.TextView
+	windows    []*Window
+	dialog     *dialog
+	inputText  string
 
-	buffer    []string
+	imStatusLine *tview.Box
+
+	buffer    []Line
 	unformed  bool
+	timestamp bool
 	scrolling bool
 	offset    int
 
-	input chan string
-}
+	searchPrompt rune
+	searchInput  []rune
+	searchRe     *regexp.Regexp
+	searchBack   bool
+	searchLine   int
+	searchMsg    string
+
+	words       []string
+	completions map[string][]string
+	keys        map[string]string
+
+	keypadPrefix *tcell.EventKey // 可能是小键盘序列开头的 Alt+O，见 keypadInputCapture
+
+	status        []*statusField
+	statusBuiltin map[string]bool
 
-func init() {
-	tcell.ColorValues[tcell.ColorYellow] = 0xC7C400
-	tcell.ColorValues[tcell.ColorWhite] = 0xC7C7C7
-	tcell.ColorValues[tcell.ColorGreen] = 0x00C200
+	width, height int
+
+	input  chan string
+	events chan Event
 }
 
+var (
+	wordRe = regexp.MustCompile(`[A-Za-z][\w'-]+`)
+)
+
 func NewUI(config Config) *UI {
-	return &UI{
-		config: config,
-		input:  make(chan string, 10),
+	ui := &UI{
+		config:      config,
+		timestamp:   config.Timestamp,
+		input:       make(chan string, 10),
+		events:      make(chan Event, 64),
+		completions: make(map[string][]string),
+		keys:        make(map[string]string),
+
+		statusBuiltin: make(map[string]bool),
+	}
+
+	ui.render, ui.renderErr = newRenderer(config)
+
+	for _, name := range strings.Split(config.StatusFields, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			ui.statusBuiltin[name] = true
+		}
 	}
+
+	return ui
 }
 
 func (ui *UI) Create(title string) {
@@ -71,7 +154,7 @@ func (ui *UI) Create(title string) {
 			ui.app.Draw()
 		})
 
-	ui.ansiWriter = tview.ANSIWriter(ui.realtimeTV)
+	ui.ansiWriter = newANSIWriter(ui.realtimeTV, ui.render)
 
 	ui.cmdLine = NewReadline()
 	ui.cmdLine.SetRepeat(true).
@@ -81,6 +164,13 @@ func (ui *UI) Create(title string) {
 		SetLabel("命令: ")
 
 	ui.cmdLine.SetChangedFunc(ui.cmdLineTextChanged)
+	ui.cmdLine.SetCompleter(ui.complete)
+
+	ui.statusTV = tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(false).
+		SetWrap(false)
+	ui.statusTV.SetBackgroundColor(tcell.ColorNavy)
 
 	ui.sepLine = tview.NewTextView().
 		SetTextAlign(tview.AlignCenter)
@@ -96,25 +186,67 @@ func (ui *UI) Create(title string) {
 		AddPage("historyView", historyView, true, false).
 		AddPage("mainView", ui.realtimeTV, true, true)
 
-	mainView := tview.NewFlex().SetDirection(tview.FlexRow).
-		AddItem(ui.pages, 0, 1, false).
-		AddItem(ui.cmdLine, 1, 1, false)
-
 	if runtime.GOOS == "windows" {
-		imStatusLine := tview.NewBox()
-		mainView.AddItem(imStatusLine, 1, 1, false)
+		ui.imStatusLine = tview.NewBox()
+	}
+
+	ui.createWindows()
+
+	if ui.config.Mouse {
+		ui.enableMouse()
 	}
 
-	ui.app.SetRoot(mainView, true).
+	ui.root = tview.NewPages().
+		AddPage("main", ui.layout(), true, true)
+
+	ui.app.SetRoot(ui.root, true).
 		SetFocus(ui.cmdLine).
-		SetInputCapture(ui.InputCapture)
+		SetInputCapture(ui.InputCapture).
+		SetBeforeDrawFunc(ui.checkResize)
+
+	if ui.renderErr != nil {
+		ui.Printf("颜色配置有误: %v\n", ui.renderErr)
+	}
+
+	for key, binding := range ui.config.Keys {
+		if err := ui.BindKey(key, binding); err != nil {
+			ui.Printf("按键 %s 的绑定有误: %v\n", key, err)
+		}
+	}
 }
 
 func (ui *UI) InputCapture(event *tcell.EventKey) *tcell.EventKey {
+	if event = ui.keypadInputCapture(event); event == nil {
+		return nil
+	}
+
+	return ui.inputCapture(event)
+}
+
+func (ui *UI) inputCapture(event *tcell.EventKey) *tcell.EventKey {
 	key := event.Key()
+	ui.emitKeypress(event)
+
+	if ui.hasDialog() {
+		return ui.dialogInputCapture(event)
+	}
+
+	if !ui.isSearchPrompting() && ui.handleKeyBinding(event) {
+		return nil
+	}
+
+	if key == tcell.KeyCtrlO && !ui.isSearchPrompting() {
+		ui.focusNextWindow()
+		return nil
+	}
+
+	if w := ui.focusedWindow(); w != nil {
+		ui.windowInputCapture(w, event)
+		return nil
+	}
 
 	if ui.isScrolling() {
-		if key == tcell.KeyCtrlC {
+		if key == tcell.KeyCtrlC && !ui.isSearchPrompting() {
 			ui.stopScrolling()
 			ui.app.SetFocus(ui.cmdLine)
 		} else {
@@ -139,7 +271,56 @@ func (ui *UI) InputCapture(event *tcell.EventKey) *tcell.EventKey {
 	return ui.cmdLine.InputCapture(event)
 }
 
+// SetPasswordMode 切换命令行的密码输入模式，在服务器关闭/恢复回显时调用
+func (ui *UI) SetPasswordMode(secret bool) {
+	ui.app.QueueUpdateDraw(func() {
+		ui.cmdLine.SetSecret(secret)
+		if secret {
+			ui.cmdLine.SetLabel("密码: ").
+				SetLabelColor(tcell.ColorRed).
+				SetFieldTextColor(tcell.ColorLightGrey)
+		} else {
+			ui.cmdLine.SetLabel("命令: ").
+				SetLabelColor(tcell.ColorWhite).
+				SetFieldTextColor(tcell.ColorLightGrey)
+		}
+	})
+}
+
+// GetInput 返回命令行中的内容，密码输入模式下返回空串
+func (ui *UI) GetInput() string {
+	ui.Lock()
+	defer ui.Unlock()
+
+	return ui.inputText
+}
+
+// SetInput 把命令行的内容设置为 text，光标移到末尾
+func (ui *UI) SetInput(text string) {
+	ui.app.QueueUpdateDraw(func() {
+		ui.cmdLine.SetText(text)
+	})
+}
+
+// InsertInput 在命令行的光标处插入 text
+func (ui *UI) InsertInput(text string) {
+	ui.app.QueueUpdateDraw(func() {
+		ui.cmdLine.Insert(text)
+	})
+}
+
 func (ui *UI) cmdLineTextChanged(text string) {
+	ui.Lock()
+	ui.inputText = text
+	if ui.cmdLine.IsSecret() {
+		ui.inputText = ""
+	}
+	ui.Unlock()
+
+	if ui.cmdLine.IsSecret() {
+		return
+	}
+
 	if len(text) == 0 {
 		return
 	}
@@ -169,6 +350,11 @@ func (ui *UI) cmdLineTextChanged(text string) {
 }
 
 func (ui *UI) historyInputCapture(event *tcell.EventKey) *tcell.EventKey {
+	if ui.isSearchPrompting() {
+		ui.searchInputCapture(event)
+		return nil
+	}
+
 	switch event.Key() {
 	case tcell.KeyCtrlB, tcell.KeyPgUp:
 		ui.pageUp(10)
@@ -184,6 +370,12 @@ func (ui *UI) historyInputCapture(event *tcell.EventKey) *tcell.EventKey {
 			ui.pageHome()
 		case 'G':
 			ui.pageEnd()
+		case '/', '?':
+			ui.startSearchPrompt(event.Rune())
+		case 'n':
+			ui.searchNext(false)
+		case 'N':
+			ui.searchNext(true)
 		}
 	default:
 	}
@@ -232,13 +424,59 @@ func (ui *UI) stopScrolling() {
 	}
 
 	ui.pages.SwitchToPage("mainView")
+	ui.scrolling = false
+	ui.searchPrompt = 0
+	ui.searchMsg = ""
+	ui.drawRealtime()
+}
+
+// drawRealtime 根据历史记录重绘实时文本区域，调用者需持有锁
+func (ui *UI) drawRealtime() {
 	end := len(ui.buffer)
 	_, _, _, height := ui.pages.GetRect()
 	ui.offset = end - height
-	ui.scrolling = false
-	text := strings.Join(ui.buffer[ui.offset:end], "\n")
-	text = tview.TranslateANSI(text + "\n")
-	ui.realtimeTV.SetText(text)
+	if ui.offset < 0 {
+		ui.offset = 0
+	}
+	text := ui.joinLines(ui.buffer[ui.offset:end])
+	ui.ansiWriter.setText(ui.realtimeTV, text+"\n")
+}
+
+// joinLines 把若干行历史记录连接为用于显示的文本，调用者需持有锁
+func (ui *UI) joinLines(lines []Line) string {
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		text := line.display(ui.timestamp)
+		if ui.searchRe != nil && ui.scrolling {
+			text = highlightMatches(text, ui.searchRe)
+		}
+		texts = append(texts, text)
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+// SetTimestamp 设置是否在每行前显示时间戳，并重绘界面
+func (ui *UI) SetTimestamp(timestamp bool) {
+	ui.Lock()
+	defer ui.Unlock()
+
+	ui.timestamp = timestamp
+	if ui.scrolling {
+		ui.drawHistory()
+	} else {
+		ui.drawRealtime()
+	}
+}
+
+// ToggleTimestamp 切换时间戳的显示状态，返回切换后的状态
+func (ui *UI) ToggleTimestamp() bool {
+	ui.Lock()
+	timestamp := !ui.timestamp
+	ui.Unlock()
+
+	ui.SetTimestamp(timestamp)
+	return timestamp
 }
 
 func (ui *UI) isScrolling() bool {
@@ -313,14 +551,46 @@ func (ui *UI) drawHistory() {
 		}
 	}
 
-	hint := "PageUp/PageDown/Ctrl+B/F 向上/下翻屏, k/j 向上/下滚动, g/G 滚到头/尾, Ctrl+C 结束翻屏"
-	status := fmt.Sprintf("%d~%d/%d(%d%%)", ui.offset, end, stopLine, ui.offset*100/stopLine)
+	hint := "PageUp/PageDown/Ctrl+B/F 向上/下翻屏, k/j 向上/下滚动, g/G 滚到头/尾, /? 搜索, n/N 下/上一个, Ctrl+C 结束翻屏"
+	if ui.searchPrompt != 0 {
+		hint = string(ui.searchPrompt) + string(ui.searchInput) + "_"
+	} else if ui.searchMsg != "" {
+		hint = ui.searchMsg
+	}
+	percent := 100
+	if stopLine > 0 {
+		percent = ui.offset * 100 / stopLine
+	}
+	status := fmt.Sprintf("%d~%d/%d(%d%%)", ui.offset, end, stopLine, percent)
 	ui.sepLine.SetText(fmt.Sprintf("%s %25s", hint, status))
-	text := strings.Join(ui.buffer[ui.offset:end], "\n")
-	text = tview.TranslateANSI(text)
+
+	text := ui.joinLines(ui.buffer[ui.offset:end])
+	text, _ = ui.render.translate(text, ansi.Style{})
 	ui.historyTV.SetText(text)
 }
 
+// Lines 返回历史记录中最后 n 行的内容，保留了 ANSI 控制码，n 不大于 0 时返回空
+func (ui *UI) Lines(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+
+	ui.Lock()
+	defer ui.Unlock()
+
+	start := len(ui.buffer) - n
+	if start < 0 {
+		start = 0
+	}
+
+	lines := make([]string, 0, len(ui.buffer)-start)
+	for _, line := range ui.buffer[start:] {
+		lines = append(lines, line.Text)
+	}
+
+	return lines
+}
+
 func (ui *UI) SetOutput(w io.Writer) {
 }
 
@@ -345,12 +615,23 @@ func (ui *UI) Print(a ...interface{}) (n int, err error) {
 	defer ui.Unlock()
 	l := len(ui.buffer)
 	if ui.unformed {
-		ui.buffer[l-1] += lines[0]
+		ui.buffer[l-1].Text += lines[0]
 		i++
 	}
 
+	// 新的一行从 lines[i] 开始，需要显示时间戳时在这些行的行首加上时间戳
+	now := time.Now()
+	output := str
+	if ui.timestamp {
+		shown := append([]string(nil), lines...)
+		for j := i; j < count; j++ {
+			shown[j] = timestampPrefix(now) + shown[j]
+		}
+		output = strings.Join(shown, "\n")
+	}
+
 	for ; i < count; i++ {
-		ui.buffer = append(ui.buffer, lines[i])
+		ui.buffer = append(ui.buffer, Line{Time: now, Text: lines[i]})
 	}
 
 	if len(ui.buffer) > ui.config.HistoryLines {
@@ -359,8 +640,9 @@ func (ui *UI) Print(a ...interface{}) (n int, err error) {
 	}
 
 	ui.unformed = unformed
+	ui.rememberWords(str)
 
-	fmt.Fprint(ui.ansiWriter, str)
+	fmt.Fprint(ui.ansiWriter, output)
 
 	return len(str), nil
 }
@@ -374,3 +656,64 @@ func (ui *UI) Printf(format string, a ...interface{}) (n int, err error) {
 	str := fmt.Sprintf(format, a...)
 	return ui.Print(str)
 }
+
+// SetCompletions 设置名为 source 的 Tab 补全候选词列表，words 为空时删除该来源
+func (ui *UI) SetCompletions(source string, words []string) {
+	ui.Lock()
+	defer ui.Unlock()
+
+	if len(words) == 0 {
+		delete(ui.completions, source)
+		return
+	}
+
+	ui.completions[source] = append([]string(nil), words...)
+}
+
+// rememberWords 记录最近输出中出现的单词，以供 Tab 补全使用，调用者需持有锁
+func (ui *UI) rememberWords(str string) {
+	if ui.config.CompleteWords <= 0 {
+		return
+	}
+
+	words := wordRe.FindAllString(ansi.Strip(str), -1)
+	ui.words = append(ui.words, words...)
+	if len(ui.words) > ui.config.CompleteWords {
+		ui.words = ui.words[len(ui.words)-ui.config.CompleteWords:]
+	}
+}
+
+// complete 返回以 word 开头的候选词，最近出现的单词优先，其次是各补全来源中的词
+func (ui *UI) complete(word string) []string {
+	ui.Lock()
+	defer ui.Unlock()
+
+	prefix := strings.ToLower(word)
+	seen := map[string]bool{word: true}
+	candidates := []string{}
+
+	add := func(w string) {
+		if !seen[w] && strings.HasPrefix(strings.ToLower(w), prefix) {
+			seen[w] = true
+			candidates = append(candidates, w)
+		}
+	}
+
+	for i := len(ui.words) - 1; i >= 0; i-- {
+		add(ui.words[i])
+	}
+
+	sources := make([]string, 0, len(ui.completions))
+	for source := range ui.completions {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		for _, w := range ui.completions[source] {
+			add(w)
+		}
+	}
+
+	return candidates
+}
@@ -0,0 +1,487 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/tview"
+
+	"github.com/mudclient/go-mud/ansi"
+)
+
+const (
+	defaultWindowRows    = 8
+	defaultWindowColumns = 40
+	defaultWindowLines   = 1000
+)
+
+// WindowConfig 是一个附加窗口的配置，附加窗口用来单独显示聊天、谣言等频道的内容
+type WindowConfig struct {
+	Name     string
+	Pattern  string // 匹配该正则的行会被复制到窗口中
+	Position string // 窗口位置，可选值: top/bottom/left/right
+	Size     int    // 窗口高度（top/bottom）或宽度（left/right），包含边框
+	Lines    int    // 窗口保留的行数
+	Hidden   bool
+}
+
+// Window 是主窗口之外的附加窗口，有自己独立的回滚缓冲区
+type Window struct {
+	config WindowConfig
+	re     *regexp.Regexp
+
+	tv     *tview.TextView
+	writer *ansiWriter
+	buffer []string
+}
+
+func (ui *UI) newWindow(config WindowConfig) (*Window, error) {
+	w := &Window{config: config}
+
+	if config.Pattern != "" {
+		re, err := regexp.Compile(config.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		w.re = re
+	}
+
+	switch w.config.Position {
+	case "top", "bottom", "left", "right":
+	default:
+		w.config.Position = "top"
+	}
+
+	if w.config.Size <= 0 {
+		w.config.Size = defaultWindowRows
+		if w.isColumn() {
+			w.config.Size = defaultWindowColumns
+		}
+	}
+
+	if w.config.Lines <= 0 {
+		w.config.Lines = defaultWindowLines
+	}
+
+	w.tv = tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetChangedFunc(func() {
+			ui.app.Draw()
+		})
+	w.tv.SetBorder(true).
+		SetTitle(" " + config.Name + " ").
+		SetBorderColor(tcell.ColorBlue)
+	w.writer = newANSIWriter(w.tv, ui.render)
+
+	return w, nil
+}
+
+func (w *Window) isColumn() bool {
+	return w.config.Position == "left" || w.config.Position == "right"
+}
+
+func (w *Window) println(line string) {
+	w.buffer = append(w.buffer, line)
+	if len(w.buffer) > w.config.Lines*2 {
+		// 超出保留行数较多时才统一裁剪，以免每行都重绘整个窗口
+		w.buffer = w.buffer[len(w.buffer)-w.config.Lines:]
+		w.writer.setText(w.tv, strings.Join(w.buffer, "\n")+"\n")
+		return
+	}
+
+	fmt.Fprintln(w.writer, line)
+}
+
+// wrappedLines 估算窗口中的内容在宽度为 width 时折行后的行数
+func (w *Window) wrappedLines(width int) int {
+	if width <= 0 {
+		return len(w.buffer)
+	}
+
+	n := 0
+	for _, line := range w.buffer {
+		lines := (runewidth.StringWidth(ansi.Strip(line)) + width - 1) / width
+		if lines < 1 {
+			lines = 1
+		}
+		n += lines
+	}
+
+	return n
+}
+
+// scroll 把窗口向下滚动 lines 行（负数表示向上），滚动到底部时恢复跟随新的内容，调用者需持有锁
+func (w *Window) scroll(lines int) {
+	row, _ := w.tv.GetScrollOffset()
+	_, _, width, height := w.tv.GetInnerRect()
+
+	row += lines
+	if row < 0 {
+		row = 0
+	}
+	if lines > 0 && row+height >= w.wrappedLines(width) {
+		w.tv.ScrollToEnd()
+		return
+	}
+
+	w.tv.ScrollTo(row, 0)
+}
+
+// setFocused 用边框的颜色表示窗口是否拥有焦点
+func (w *Window) setFocused(focused bool) {
+	color := tcell.ColorBlue
+	if focused {
+		color = tcell.ColorYellow
+	}
+	w.tv.SetBorderColor(color)
+}
+
+// findWindowTV 返回显示在 tv 中的附加窗口，窗口不存在或者被隐藏时返回 nil，调用者需持有锁
+func (ui *UI) findWindowTV(tv tview.Primitive) *Window {
+	for _, w := range ui.windows {
+		if w.tv == tv && !w.config.Hidden {
+			return w
+		}
+	}
+
+	return nil
+}
+
+// focusedWindow 返回拥有焦点的附加窗口，焦点不在附加窗口上时返回 nil
+func (ui *UI) focusedWindow() *Window {
+	focus := ui.app.GetFocus()
+
+	ui.Lock()
+	defer ui.Unlock()
+
+	return ui.findWindowTV(focus)
+}
+
+// mainFocus 返回离开附加窗口时应该获得焦点的部件，调用者需持有锁
+func (ui *UI) mainFocus() tview.Primitive {
+	if ui.scrolling {
+		return ui.historyTV
+	}
+
+	return ui.cmdLine
+}
+
+// focusNextWindow 把焦点依次切换到下一个显示着的附加窗口，最后一个窗口之后回到命令行，
+// 拥有焦点的窗口可以用方向键、PgUp、PgDn、Home、End 滚动，必须在界面的事件循环中调用
+func (ui *UI) focusNextWindow() {
+	current := ui.focusedWindow()
+
+	ui.Lock()
+	var next *Window
+	found := current == nil
+	for _, w := range ui.windows {
+		if w.config.Hidden {
+			continue
+		}
+		if found {
+			next = w
+			break
+		}
+		found = w == current
+	}
+	if current != nil {
+		current.setFocused(false)
+	}
+
+	var focus tview.Primitive
+	if next != nil {
+		next.setFocused(true)
+		focus = next.tv
+	} else {
+		focus = ui.mainFocus()
+	}
+	ui.Unlock()
+
+	ui.app.SetFocus(focus)
+}
+
+// windowInputCapture 处理焦点在附加窗口上时的按键，Esc、Enter 或者 Ctrl+C 离开窗口
+func (ui *UI) windowInputCapture(w *Window, event *tcell.EventKey) {
+	ui.Lock()
+	var focus tview.Primitive
+	_, _, _, height := w.tv.GetInnerRect()
+	switch event.Key() {
+	case tcell.KeyUp:
+		w.scroll(-1)
+	case tcell.KeyDown:
+		w.scroll(1)
+	case tcell.KeyPgUp, tcell.KeyCtrlB:
+		w.scroll(-height)
+	case tcell.KeyPgDn, tcell.KeyCtrlF:
+		w.scroll(height)
+	case tcell.KeyHome:
+		w.tv.ScrollToBeginning()
+	case tcell.KeyEnd:
+		w.tv.ScrollToEnd()
+	case tcell.KeyEscape, tcell.KeyEnter, tcell.KeyCtrlC:
+		w.setFocused(false)
+		focus = ui.mainFocus()
+	}
+	ui.Unlock()
+
+	if focus != nil {
+		ui.app.SetFocus(focus)
+	}
+}
+
+// createWindows 根据配置创建附加窗口，配置有误的窗口会被忽略
+func (ui *UI) createWindows() {
+	for _, config := range ui.config.Windows {
+		if config.Name == "" || ui.findWindow(config.Name) != nil {
+			continue
+		}
+
+		w, err := ui.newWindow(config)
+		if err != nil {
+			ui.Printf("窗口 %s 的配置有误: %v\n", config.Name, err)
+			continue
+		}
+
+		ui.windows = append(ui.windows, w)
+	}
+}
+
+// findWindow 按名称查找附加窗口，调用者需持有锁
+func (ui *UI) findWindow(name string) *Window {
+	for _, w := range ui.windows {
+		if w.config.Name == name {
+			return w
+		}
+	}
+
+	return nil
+}
+
+// layout 生成整个界面的布局，附加窗口按配置的先后顺序依次围绕在主窗口四周
+func (ui *UI) layout() tview.Primitive {
+	ui.Lock()
+	defer ui.Unlock()
+
+	var output tview.Primitive = ui.pages
+	for _, w := range ui.windows {
+		if w.config.Hidden {
+			continue
+		}
+
+		flex := tview.NewFlex().SetDirection(tview.FlexRow)
+		if w.isColumn() {
+			flex.SetDirection(tview.FlexColumn)
+		}
+
+		switch w.config.Position {
+		case "top", "left":
+			flex.AddItem(w.tv, w.config.Size, 0, false).
+				AddItem(output, 0, 1, false)
+		default:
+			flex.AddItem(output, 0, 1, false).
+				AddItem(w.tv, w.config.Size, 0, false)
+		}
+
+		output = flex
+	}
+
+	mainView := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(output, 0, 1, false)
+
+	if lines := ui.statusLines(); lines > 0 {
+		mainView.AddItem(ui.statusTV, lines, 0, false)
+	}
+
+	mainView.AddItem(ui.cmdLine, 1, 1, false)
+
+	if ui.imStatusLine != nil {
+		mainView.AddItem(ui.imStatusLine, 1, 1, false)
+	}
+
+	return mainView
+}
+
+// relayout 在附加窗口发生变化后重新布局界面
+func (ui *UI) relayout() {
+	ui.app.QueueUpdateDraw(func() {
+		focus := ui.app.GetFocus()
+		ui.Lock()
+		if tv, ok := focus.(*tview.TextView); ok && tv != ui.historyTV && ui.findWindowTV(tv) == nil {
+			// 拥有焦点的窗口已经被关闭或者隐藏
+			focus = ui.mainFocus()
+		}
+		for _, w := range ui.windows {
+			w.setFocused(w.tv == focus)
+		}
+		ui.Unlock()
+
+		// 重新加入的页面会在最前面，对话框要保持在界面的最前面
+		ui.root.AddPage("main", ui.layout(), true, true).
+			SendToBack("main")
+		ui.app.SetFocus(focus)
+	})
+}
+
+// CaptureLine 把匹配附加窗口配置的行复制到相应的窗口中，plain 为去掉了控制码的纯文本
+func (ui *UI) CaptureLine(plain, line string) {
+	ui.Lock()
+	defer ui.Unlock()
+
+	for _, w := range ui.windows {
+		if w.re != nil && w.re.MatchString(plain) {
+			w.println(line)
+		}
+	}
+}
+
+// CaptureTo 把一行内容输出到名为 name 的附加窗口，窗口不存在时自动创建
+func (ui *UI) CaptureTo(name, line string) error {
+	ui.Lock()
+	w := ui.findWindow(name)
+	created := w == nil
+	if created {
+		var err error
+		if w, err = ui.newWindow(WindowConfig{Name: name}); err != nil {
+			ui.Unlock()
+			return err
+		}
+		ui.windows = append(ui.windows, w)
+	}
+
+	w.println(line)
+	ui.Unlock()
+
+	if created {
+		ui.relayout()
+	}
+
+	return nil
+}
+
+// OpenWindow 在 position 处创建大小为 size 的附加窗口，size 为 0 时使用默认大小，
+// 同名的窗口已经存在时只显示它
+func (ui *UI) OpenWindow(name, position string, size int) error {
+	ui.Lock()
+	w := ui.findWindow(name)
+	if w != nil {
+		w.config.Hidden = false
+	} else {
+		var err error
+		config := WindowConfig{Name: name, Position: position, Size: size}
+		if w, err = ui.newWindow(config); err != nil {
+			ui.Unlock()
+			return err
+		}
+		ui.windows = append(ui.windows, w)
+	}
+	ui.Unlock()
+
+	ui.relayout()
+	return nil
+}
+
+// CloseWindow 关闭并删除附加窗口，窗口中的内容也随之丢弃
+func (ui *UI) CloseWindow(name string) error {
+	ui.Lock()
+	found := false
+	for i, w := range ui.windows {
+		if w.config.Name == name {
+			ui.windows = append(ui.windows[:i], ui.windows[i+1:]...)
+			found = true
+			break
+		}
+	}
+	ui.Unlock()
+
+	if !found {
+		return fmt.Errorf("窗口 %s 不存在", name)
+	}
+
+	ui.relayout()
+	return nil
+}
+
+// ShowWindow 显示或隐藏附加窗口
+func (ui *UI) ShowWindow(name string, show bool) error {
+	ui.Lock()
+	w := ui.findWindow(name)
+	if w != nil {
+		w.config.Hidden = !show
+	}
+	ui.Unlock()
+
+	if w == nil {
+		return fmt.Errorf("窗口 %s 不存在", name)
+	}
+
+	ui.relayout()
+	return nil
+}
+
+// ToggleWindow 切换附加窗口的显示状态
+func (ui *UI) ToggleWindow(name string) error {
+	ui.Lock()
+	w := ui.findWindow(name)
+	show := w != nil && w.config.Hidden
+	ui.Unlock()
+
+	return ui.ShowWindow(name, show)
+}
+
+// ResizeWindow 调整附加窗口的大小
+func (ui *UI) ResizeWindow(name string, size int) error {
+	if size < 3 {
+		return fmt.Errorf("窗口大小至少为 3")
+	}
+
+	ui.Lock()
+	w := ui.findWindow(name)
+	if w != nil {
+		w.config.Size = size
+	}
+	ui.Unlock()
+
+	if w == nil {
+		return fmt.Errorf("窗口 %s 不存在", name)
+	}
+
+	ui.relayout()
+	return nil
+}
+
+// ClearWindow 清空附加窗口的内容
+func (ui *UI) ClearWindow(name string) error {
+	ui.Lock()
+	defer ui.Unlock()
+
+	w := ui.findWindow(name)
+	if w == nil {
+		return fmt.Errorf("窗口 %s 不存在", name)
+	}
+
+	w.buffer = nil
+	w.writer.setText(w.tv, "")
+	return nil
+}
+
+// Windows 返回所有附加窗口的描述信息
+func (ui *UI) Windows() []string {
+	ui.Lock()
+	defer ui.Unlock()
+
+	list := make([]string, 0, len(ui.windows))
+	for _, w := range ui.windows {
+		state := "显示"
+		if w.config.Hidden {
+			state = "隐藏"
+		}
+		list = append(list, fmt.Sprintf("%-10s %-6s 大小 %-4d %s %s",
+			w.config.Name, w.config.Position, w.config.Size, state, w.config.Pattern))
+	}
+
+	return list
+}